@@ -0,0 +1,110 @@
+package broadcastState
+
+import (
+	"encoding/json"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+var (
+	epoch   = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	testKey = []byte("0123456789abcdef")
+)
+
+func packet(t *testing.T, cluster string, sender string, seq uint64, now time.Time, sec Security) []byte {
+	t.Helper()
+	p, err := makePacket(structs.ElevatorDataWithID{ElevatorID: sender}, cluster, seq, now, sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// tamper changes the payload of a packet, keeping its MAC.
+func tamper(t *testing.T, p []byte) []byte {
+	t.Helper()
+	var env envelope
+	if err := json.Unmarshal(p, &env); err != nil {
+		t.Fatal(err)
+	}
+	env.Payload = []byte(`{"id":"forged"}`)
+	forged, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return forged
+}
+
+func TestSignedPacketIsAccepted(t *testing.T) {
+	sec := Security{AuthKey: testKey}
+	data, reason := openPacket(packet(t, "signed", "a", 1, epoch, sec), "signed", sec, newReplayGuard(), epoch)
+	if reason != "" || data.ElevatorID != "a" {
+		t.Errorf("rejected a signed packet: %s", reason)
+	}
+}
+
+func TestForgedPacketsAreRejected(t *testing.T) {
+	sec := Security{AuthKey: testKey}
+	cases := []struct {
+		name   string
+		packet []byte
+		reason string
+	}{
+		{"tampered", tamper(t, packet(t, "forged", "a", 1, epoch, sec)), "bad signature"},
+		{"wrong key", packet(t, "forged", "b", 1, epoch, Security{AuthKey: []byte("fedcba9876543210")}), "bad signature"},
+		{"unsigned", packet(t, "forged", "c", 1, epoch, Security{}), "unsigned"},
+	}
+	for _, c := range cases {
+		if _, reason := openPacket(c.packet, "forged", sec, newReplayGuard(), epoch); reason != c.reason {
+			t.Errorf("%s packet: got %q, want %q", c.name, reason, c.reason)
+		}
+	}
+	// Only authentic senders are listed as members of the cluster
+	for _, info := range VisibleClusters(epoch) {
+		if info.ID == "forged" {
+			t.Errorf("forged senders listed: %+v", info)
+		}
+	}
+}
+
+func TestReplayedPacketsAreDropped(t *testing.T) {
+	sec := Security{AuthKey: testKey}
+	guard := newReplayGuard()
+	first := packet(t, "replay", "a", 2, epoch, sec)
+	if _, reason := openPacket(first, "replay", sec, guard, epoch); reason != "" {
+		t.Fatalf("first packet rejected: %s", reason)
+	}
+	if _, reason := openPacket(first, "replay", sec, guard, epoch); reason != "replayed or stale" {
+		t.Errorf("replayed packet: got %q", reason)
+	}
+	if _, reason := openPacket(packet(t, "replay", "a", 1, epoch, sec), "replay", sec, guard, epoch); reason != "replayed or stale" {
+		t.Errorf("reordered packet: got %q", reason)
+	}
+	if _, reason := openPacket(packet(t, "replay", "b", 1, epoch, sec), "replay", sec, guard, epoch); reason != "" {
+		t.Errorf("sequence of one sender blocked another: %s", reason)
+	}
+}
+
+func TestOldPacketsAreDropped(t *testing.T) {
+	sec := Security{AuthKey: testKey}
+	maxAge := config.MaxMessageAgeMs * time.Millisecond
+	old := packet(t, "old", "a", 1, epoch.Add(-maxAge-time.Second), sec)
+	if _, reason := openPacket(old, "old", sec, newReplayGuard(), epoch); reason != "replayed or stale" {
+		t.Errorf("old packet: got %q", reason)
+	}
+	recent := packet(t, "old", "a", 1, epoch.Add(-maxAge/2), sec)
+	if _, reason := openPacket(recent, "old", sec, newReplayGuard(), epoch); reason != "" {
+		t.Errorf("recent packet rejected: %s", reason)
+	}
+}
+
+func TestNoGuardWithoutKey(t *testing.T) {
+	guard := newReplayGuard()
+	// A forged high sequence number must not block the real sender
+	openPacket(packet(t, "open", "a", 1000, epoch, Security{}), "open", Security{}, guard, epoch)
+	if _, reason := openPacket(packet(t, "open", "a", 1, epoch, Security{}), "open", Security{}, guard, epoch); reason != "" {
+		t.Errorf("packet without key rejected: %s", reason)
+	}
+}
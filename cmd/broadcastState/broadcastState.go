@@ -1,22 +1,158 @@
 package broadcastState
 
 import (
-	"Network-go/network/bcast"
+	"encoding/json"
+	"fmt"
+	"sanntids/cmd/clock"
 	"sanntids/cmd/structs"
+	"time"
 )
 
-func BroadcastState(dataChan <-chan structs.ElevatorDataWithID, port int) {
-	broadcastChan := make(chan structs.ElevatorDataWithID)
-	go bcast.Transmitter(port, broadcastChan)
+const maxPacketSize = 65536
+
+const reasonForeignCluster = "from another cluster"
+
+// BroadcastState sends every ElevatorDataWithID from dataChan over the
+// transport, tagged with cluster, encrypted and signed as configured in sec.
+func BroadcastState(clk clock.Clock, dataChan <-chan structs.ElevatorDataWithID, transport Transport, cluster string, sec Security) {
+	packetConn, addrs, err := transport.dial()
+	if err != nil {
+		fmt.Println("Error opening", transport.Mode, "transport:", err)
+		return
+	}
+
+	seq := uint64(clk.Now().UnixNano())
 	for dataWithID := range dataChan {
-		broadcastChan <- dataWithID
+		seq++
+		packet, err := makePacket(dataWithID, cluster, seq, clk.Now(), sec)
+		if err != nil {
+			fmt.Println("Error packing elevator data:", err)
+			continue
+		}
+		for _, addr := range addrs {
+			if _, err := packetConn.WriteTo(packet, addr); err != nil {
+				fmt.Println("Error broadcasting state:", err)
+			}
+		}
 	}
 }
 
-func ReceiveState(dataChan chan<- structs.ElevatorDataWithID, port int) {
-	receiveChan := make(chan structs.ElevatorDataWithID)
-	go bcast.Receiver(port, receiveChan)
-	for receivedDataWithID := range receiveChan {
-		dataChan <- receivedDataWithID
+// makePacket puts data in an envelope for cluster, encrypted and signed as
+// configured in sec.
+func makePacket(data structs.ElevatorDataWithID, cluster string, seq uint64, now time.Time, sec Security) ([]byte, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	env := envelope{
+		Cluster:   cluster,
+		Sender:    data.ElevatorID,
+		Seq:       seq,
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+		Payload:   payload,
+	}
+	if sec.Encryption != nil {
+		if err := sec.Encryption.seal(&env); err != nil {
+			return nil, err
+		}
+	}
+	if sec.AuthKey != nil {
+		env.sign(sec.AuthKey)
+	}
+	return json.Marshal(env)
+}
+
+// ReceiveState passes on the ElevatorDataWithID sent over the transport by
+// the other elevators of cluster. Packets from other clusters, replayed packets and
+// packets not signed or encrypted as sec requires are dropped and counted
+// in GetStats.
+func ReceiveState(clk clock.Clock, dataChan chan<- structs.ElevatorDataWithID, transport Transport, cluster string, sec Security) {
+	packetConn, err := transport.listen()
+	if err != nil {
+		fmt.Println("Error opening", transport.Mode, "transport:", err)
+		return
+	}
+	guard := newReplayGuard()
+	buf := make([]byte, maxPacketSize)
+	var lastReport time.Time
+
+	for {
+		n, from, err := packetConn.ReadFrom(buf)
+		if err != nil {
+			fmt.Println("Error receiving state:", err)
+			continue
+		}
+		data, reason := openPacket(buf[:n], cluster, sec, guard, clk.Now())
+		if reason == reasonForeignCluster {
+			// Other clusters sharing the port are expected and only counted
+			continue
+		}
+		if reason != "" {
+			// Someone flooding the port should not flood the terminal as well
+			if now := clk.Now(); now.Sub(lastReport) > time.Second {
+				lastReport = now
+				fmt.Printf("Rejected packet from %v: %s (totals %+v)\n", from, reason, GetStats())
+			}
+			continue
+		}
+		dataChan <- data
+	}
+}
+
+// openPacket checks and unpacks a received packet, returning why it was
+// rejected if it was. Sequence numbers and senders are only trusted once the
+// packet is known to be authentic, so forged packets cannot block real ones
+// or show up as members of the cluster. Without a key nothing is authentic,
+// and as anyone could then block a sender with a high sequence number, the
+// replay guard is left out as well.
+func openPacket(packet []byte, cluster string, sec Security, guard *replayGuard, now time.Time) (structs.ElevatorDataWithID, string) {
+	var data structs.ElevatorDataWithID
+	var env envelope
+	if err := json.Unmarshal(packet, &env); err != nil {
+		atomicInc(&stats.Malformed)
+		return data, "malformed envelope"
+	}
+	if env.Cluster != cluster {
+		// The keys of other clusters are not known, so they are listed as they claim to be
+		noteCluster(env.Cluster, env.Sender, now)
+		atomicInc(&stats.ForeignCluster)
+		return data, reasonForeignCluster
+	}
+	if sec.AuthKey != nil {
+		if len(env.MAC) == 0 {
+			atomicInc(&stats.Unsigned)
+			return data, "unsigned"
+		}
+		if !env.verify(sec.AuthKey) {
+			atomicInc(&stats.BadSignature)
+			return data, "bad signature"
+		}
+	}
+	encrypted := len(env.KeyID) > 0
+	if sec.Encryption != nil && !encrypted {
+		atomicInc(&stats.Unencrypted)
+		return data, "unencrypted"
+	}
+	if encrypted {
+		if sec.Encryption == nil {
+			atomicInc(&stats.Undecryptable)
+			return data, "encrypted but no key configured"
+		}
+		if err := sec.Encryption.open(&env); err != nil {
+			atomicInc(&stats.Undecryptable)
+			return data, err.Error()
+		}
+	}
+	authentic := sec.AuthKey != nil || sec.Encryption != nil
+	if authentic && !guard.accept(env, now) {
+		atomicInc(&stats.Replayed)
+		return data, "replayed or stale"
+	}
+	if err := json.Unmarshal(env.Payload, &data); err != nil || data.ElevatorID != env.Sender {
+		atomicInc(&stats.Malformed)
+		return structs.ElevatorDataWithID{}, "malformed payload"
 	}
+	noteCluster(env.Cluster, env.Sender, now)
+	atomicInc(&stats.Accepted)
+	return data, ""
 }
@@ -0,0 +1,109 @@
+package broadcastState
+
+import (
+	"encoding/json"
+	"sanntids/cmd/clock"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Packets from other clusters are not authenticated, so only a bounded
+// number of senders is remembered, and only for a while.
+const (
+	maxSeenSenders = 256
+	clusterExpiry  = 10 * time.Second
+)
+
+// ClusterInfo describes a cluster heard on the transport.
+type ClusterInfo struct {
+	ID       string    `json:"id"`
+	Senders  []string  `json:"senders"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+type clusterSender struct {
+	cluster string
+	sender  string
+}
+
+var seenClusters = struct {
+	sync.Mutex
+	lastSeen map[clusterSender]time.Time
+}{lastSeen: make(map[clusterSender]time.Time)}
+
+func noteCluster(cluster string, sender string, now time.Time) {
+	seenClusters.Lock()
+	defer seenClusters.Unlock()
+
+	key := clusterSender{cluster, sender}
+	if _, known := seenClusters.lastSeen[key]; !known && len(seenClusters.lastSeen) >= maxSeenSenders {
+		forgetExpiredClusters(now)
+		if len(seenClusters.lastSeen) >= maxSeenSenders {
+			return
+		}
+	}
+	seenClusters.lastSeen[key] = now
+}
+
+func forgetExpiredClusters(now time.Time) {
+	for key, lastSeen := range seenClusters.lastSeen {
+		if now.Sub(lastSeen) > clusterExpiry {
+			delete(seenClusters.lastSeen, key)
+		}
+	}
+}
+
+// VisibleClusters returns the clusters heard on the transport lately,
+// including this node's own, sorted by ID.
+func VisibleClusters(now time.Time) []ClusterInfo {
+	seenClusters.Lock()
+	defer seenClusters.Unlock()
+	forgetExpiredClusters(now)
+
+	byID := make(map[string]*ClusterInfo)
+	for key, lastSeen := range seenClusters.lastSeen {
+		info, ok := byID[key.cluster]
+		if !ok {
+			info = &ClusterInfo{ID: key.cluster}
+			byID[key.cluster] = info
+		}
+		info.Senders = append(info.Senders, key.sender)
+		if lastSeen.After(info.LastSeen) {
+			info.LastSeen = lastSeen
+		}
+	}
+
+	clusters := make([]ClusterInfo, 0, len(byID))
+	for _, info := range byID {
+		sort.Strings(info.Senders)
+		clusters = append(clusters, *info)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ID < clusters[j].ID })
+	return clusters
+}
+
+// ScanClusters listens on the transport for the given duration and returns
+// the clusters heard. It does not need any of the clusters' keys.
+func ScanClusters(clk clock.Clock, transport Transport, duration time.Duration) ([]ClusterInfo, error) {
+	packetConn, err := transport.listen()
+	if err != nil {
+		return nil, err
+	}
+	defer packetConn.Close()
+
+	deadline := clk.Now().Add(duration)
+	buf := make([]byte, maxPacketSize)
+	for clk.Now().Before(deadline) {
+		packetConn.SetReadDeadline(deadline)
+		n, _, err := packetConn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		var env envelope
+		if err := json.Unmarshal(buf[:n], &env); err == nil {
+			noteCluster(env.Cluster, env.Sender, clk.Now())
+		}
+	}
+	return VisibleClusters(clk.Now()), nil
+}
@@ -0,0 +1,25 @@
+package broadcastState
+
+import "testing"
+
+func TestForeignClusterIsDropped(t *testing.T) {
+	before := GetStats().ForeignCluster
+	p := packet(t, "other", "x", 1, epoch, Security{})
+	if _, reason := openPacket(p, "ours", Security{}, newReplayGuard(), epoch); reason != reasonForeignCluster {
+		t.Fatalf("packet from another cluster: got %q", reason)
+	}
+	if got := GetStats().ForeignCluster; got != before+1 {
+		t.Errorf("foreign packets counted %d, want %d", got, before+1)
+	}
+
+	// It is still listed, so a node started in the wrong cluster can be found
+	found := false
+	for _, info := range VisibleClusters(epoch) {
+		if info.ID == "other" && len(info.Senders) == 1 && info.Senders[0] == "x" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("other cluster not listed: %+v", VisibleClusters(epoch))
+	}
+}
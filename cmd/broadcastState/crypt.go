@@ -0,0 +1,93 @@
+package broadcastState
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// Encryption hides the contents of broadcasts with AES-256-GCM. Packets are
+// encrypted with the current key, while packets encrypted with either the
+// current or the previous key are accepted. To rotate keys without losing
+// traffic, first give every elevator the new key as previous key, then swap
+// the two on every elevator.
+type Encryption struct {
+	current  encryptionKey
+	previous *encryptionKey
+}
+
+type encryptionKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+const keyIDLength = 4
+
+var errUnknownKey = errors.New("packet encrypted with unknown key")
+
+// NewEncryption derives the AES keys from the secrets read from the key
+// files. previous may be nil.
+func NewEncryption(current []byte, previous []byte) (*Encryption, error) {
+	currentKey, err := newEncryptionKey(current)
+	if err != nil {
+		return nil, err
+	}
+	e := &Encryption{current: currentKey}
+	if previous != nil {
+		previousKey, err := newEncryptionKey(previous)
+		if err != nil {
+			return nil, err
+		}
+		e.previous = &previousKey
+	}
+	return e, nil
+}
+
+func newEncryptionKey(secret []byte) (encryptionKey, error) {
+	aesKey := sha256.Sum256(secret)
+	block, err := aes.NewCipher(aesKey[:])
+	if err != nil {
+		return encryptionKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return encryptionKey{}, err
+	}
+	id := sha256.Sum256(aesKey[:])
+	return encryptionKey{id: id[:keyIDLength], aead: aead}, nil
+}
+
+// seal replaces the payload of env by its encryption. The envelope header
+// is authenticated along with it.
+func (e *Encryption) seal(env *envelope) error {
+	env.KeyID = e.current.id
+	env.Nonce = make([]byte, e.current.aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	env.Payload = e.current.aead.Seal(nil, env.Nonce, env.Payload, env.header())
+	return nil
+}
+
+// open decrypts the payload of env with whichever accepted key it was encrypted with.
+func (e *Encryption) open(env *envelope) error {
+	key := e.current
+	if !bytes.Equal(env.KeyID, e.current.id) {
+		if e.previous == nil || !bytes.Equal(env.KeyID, e.previous.id) {
+			return errUnknownKey
+		}
+		key = *e.previous
+	}
+	if len(env.Nonce) != key.aead.NonceSize() {
+		return errors.New("bad nonce")
+	}
+	plaintext, err := key.aead.Open(nil, env.Nonce, env.Payload, env.header())
+	if err != nil {
+		return err
+	}
+	env.Payload = plaintext
+	return nil
+}
@@ -0,0 +1,94 @@
+package broadcastState
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	oldSecret = []byte("old cluster secret")
+	newSecret = []byte("new cluster secret")
+)
+
+func newTestEncryption(t *testing.T, current []byte, previous []byte) *Encryption {
+	t.Helper()
+	e, err := NewEncryption(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func sealed(t *testing.T, e *Encryption, payload []byte) envelope {
+	t.Helper()
+	env := envelope{Cluster: "c", Sender: "a", Seq: 1, Timestamp: 1, Payload: append([]byte(nil), payload...)}
+	if err := e.seal(&env); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	e := newTestEncryption(t, newSecret, nil)
+	payload := []byte(`{"id":"a"}`)
+	env := sealed(t, e, payload)
+	if bytes.Contains(env.Payload, payload) {
+		t.Fatalf("payload readable after sealing")
+	}
+	if err := e.open(&env); err != nil || !bytes.Equal(env.Payload, payload) {
+		t.Errorf("opened to %q, %v", env.Payload, err)
+	}
+}
+
+func TestOpenRejectsWrongKeyAndTampering(t *testing.T) {
+	e := newTestEncryption(t, newSecret, nil)
+	env := sealed(t, newTestEncryption(t, oldSecret, nil), []byte("data"))
+	if err := e.open(&env); err != errUnknownKey {
+		t.Errorf("packet with another key: got %v", err)
+	}
+
+	// The header is authenticated along with the payload
+	env = sealed(t, e, []byte("data"))
+	env.Sender = "b"
+	if err := e.open(&env); err == nil {
+		t.Errorf("packet with a changed sender opened")
+	}
+}
+
+func TestPreviousKeyAcceptedDuringRotation(t *testing.T) {
+	before := newTestEncryption(t, oldSecret, nil)
+	during := newTestEncryption(t, oldSecret, newSecret)
+	after := newTestEncryption(t, newSecret, oldSecret)
+	done := newTestEncryption(t, newSecret, nil)
+
+	// Elevators that have swapped the keys and those that have not yet understand each other
+	for _, c := range []struct {
+		name     string
+		from, to *Encryption
+	}{
+		{"before to during", before, during},
+		{"during to after", during, after},
+		{"after to during", after, during},
+		{"after to done", after, done},
+	} {
+		env := sealed(t, c.from, []byte("data"))
+		if err := c.to.open(&env); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+
+	env := sealed(t, before, []byte("data"))
+	if err := done.open(&env); err != errUnknownKey {
+		t.Errorf("old key accepted after the rotation: %v", err)
+	}
+}
+
+func TestEncryptedPacketThroughEnvelope(t *testing.T) {
+	sec := Security{Encryption: newTestEncryption(t, newSecret, nil)}
+	if _, reason := openPacket(packet(t, "crypt", "a", 1, epoch, sec), "crypt", sec, newReplayGuard(), epoch); reason != "" {
+		t.Errorf("encrypted packet rejected: %s", reason)
+	}
+	if _, reason := openPacket(packet(t, "crypt", "a", 2, epoch, Security{}), "crypt", sec, newReplayGuard(), epoch); reason != "unencrypted" {
+		t.Errorf("plain packet: got %q", reason)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package broadcastState
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setMulticastOptions sets the TTL of multicast packets sent on udpConn and,
+// if ifi is not nil, the interface they leave on.
+func setMulticastOptions(udpConn *net.UDPConn, ttl int, ifi *net.Interface) error {
+	var ifAddr [4]byte
+	if ifi != nil {
+		ip, err := interfaceIPv4(ifi)
+		if err != nil {
+			return err
+		}
+		copy(ifAddr[:], ip)
+	}
+
+	rawConn, err := udpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, ttl)
+		if sockErr == nil && ifi != nil {
+			sockErr = syscall.SetsockoptInet4Addr(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, ifAddr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+func interfaceIPv4(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+}
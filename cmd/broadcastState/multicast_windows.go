@@ -0,0 +1,10 @@
+package broadcastState
+
+import (
+	"fmt"
+	"net"
+)
+
+func setMulticastOptions(udpConn *net.UDPConn, ttl int, ifi *net.Interface) error {
+	return fmt.Errorf("multicast transport is not supported on windows")
+}
@@ -0,0 +1,164 @@
+package broadcastState
+
+import (
+	"Network-go/network/conn"
+	"fmt"
+	"net"
+)
+
+// TransportMode selects how packets reach the other elevators.
+type TransportMode string
+
+const (
+	// Broadcast sends to 255.255.255.255, which only reaches the local subnet.
+	Broadcast TransportMode = "broadcast"
+	// Multicast sends to an IP multicast group, which routers can forward.
+	Multicast TransportMode = "multicast"
+	// Unicast sends a copy of every packet to each of a fixed list of peers.
+	Unicast TransportMode = "unicast"
+)
+
+// Transport describes how the elevators of a cluster reach each other. The
+// packets and what is done with them are the same for every mode.
+type Transport struct {
+	Mode TransportMode
+	Port int
+	// Multicast only: the group, how many router hops packets may take,
+	// and the interface to use (the system chooses if empty)
+	Group     string
+	TTL       int
+	Interface string
+	// Unicast only: the other elevators as host:port. Every packet is also
+	// sent to this elevator itself, as it would hear its own broadcasts.
+	Peers []string
+}
+
+// Validate checks that the settings the mode needs are there.
+func (t Transport) Validate() error {
+	switch t.Mode {
+	case Broadcast:
+		return nil
+	case Multicast:
+		ip := net.ParseIP(t.Group)
+		if ip == nil || ip.To4() == nil || !ip.IsMulticast() {
+			return fmt.Errorf("%q is not an IPv4 multicast group", t.Group)
+		}
+		if t.TTL < 1 || t.TTL > 255 {
+			return fmt.Errorf("multicast TTL %d is not between 1 and 255", t.TTL)
+		}
+		if t.Interface != "" {
+			if _, err := net.InterfaceByName(t.Interface); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Unicast:
+		if len(t.Peers) == 0 {
+			return fmt.Errorf("unicast transport needs at least one peer")
+		}
+		for _, peer := range t.Peers {
+			if _, err := net.ResolveUDPAddr("udp4", peer); err != nil {
+				return fmt.Errorf("peer %q: %v", peer, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown transport %q", t.Mode)
+}
+
+// listen opens the socket that packets from the other elevators arrive on.
+func (t Transport) listen() (net.PacketConn, error) {
+	switch t.Mode {
+	case Multicast:
+		ifi, err := t.multicastInterface()
+		if err != nil {
+			return nil, err
+		}
+		group := &net.UDPAddr{IP: net.ParseIP(t.Group), Port: t.Port}
+		return net.ListenMulticastUDP("udp4", ifi, group)
+	case Unicast:
+		return net.ListenUDP("udp4", &net.UDPAddr{Port: t.Port})
+	}
+	return conn.DialBroadcastUDP(t.Port), nil
+}
+
+// dial opens the socket packets are sent from and returns the addresses
+// every packet is sent to.
+func (t Transport) dial() (net.PacketConn, []net.Addr, error) {
+	switch t.Mode {
+	case Multicast:
+		ifi, err := t.multicastInterface()
+		if err != nil {
+			return nil, nil, err
+		}
+		udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := setMulticastOptions(udpConn, t.TTL, ifi); err != nil {
+			udpConn.Close()
+			return nil, nil, err
+		}
+		group := &net.UDPAddr{IP: net.ParseIP(t.Group), Port: t.Port}
+		return udpConn, []net.Addr{group}, nil
+	case Unicast:
+		udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+		if err != nil {
+			return nil, nil, err
+		}
+		addrs, err := t.unicastAddrs()
+		if err != nil {
+			udpConn.Close()
+			return nil, nil, err
+		}
+		return udpConn, addrs, nil
+	}
+	addr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("255.255.255.255:%d", t.Port))
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn.DialBroadcastUDP(t.Port), []net.Addr{addr}, nil
+}
+
+// unicastAddrs returns the addresses of the peers and of this elevator. The
+// order manager counts the elevators it hears from, itself included, so in
+// the other modes it relies on hearing its own packets. A peer that is this
+// elevator is not sent to twice.
+func (t Transport) unicastAddrs() ([]net.Addr, error) {
+	self := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: t.Port}
+	addrs := []net.Addr{self}
+	for _, peer := range t.Peers {
+		addr, err := net.ResolveUDPAddr("udp4", peer)
+		if err != nil {
+			return nil, err
+		}
+		if addr.Port == t.Port && isLocalIP(addr.IP) {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	local, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range local {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Transport) multicastInterface() (*net.Interface, error) {
+	if t.Interface == "" {
+		return nil, nil
+	}
+	return net.InterfaceByName(t.Interface)
+}
@@ -0,0 +1,48 @@
+package broadcastState
+
+import (
+	"net"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name      string
+		transport Transport
+		ok        bool
+	}{
+		{"broadcast", Transport{Mode: Broadcast, Port: 16569}, true},
+		{"multicast", Transport{Mode: Multicast, Group: "239.1.2.3", TTL: 1}, true},
+		{"multicast unicast group", Transport{Mode: Multicast, Group: "10.0.0.1", TTL: 1}, false},
+		{"multicast no group", Transport{Mode: Multicast, TTL: 1}, false},
+		{"multicast TTL 0", Transport{Mode: Multicast, Group: "239.1.2.3"}, false},
+		{"multicast TTL 256", Transport{Mode: Multicast, Group: "239.1.2.3", TTL: 256}, false},
+		{"multicast unknown interface", Transport{Mode: Multicast, Group: "239.1.2.3", TTL: 1, Interface: "no-such-if0"}, false},
+		{"unicast", Transport{Mode: Unicast, Peers: []string{"10.0.0.2:16569", "localhost:16570"}}, true},
+		{"unicast no peers", Transport{Mode: Unicast}, false},
+		{"unicast bad peer", Transport{Mode: Unicast, Peers: []string{"10.0.0.2"}}, false},
+		{"unknown mode", Transport{Mode: "carrier-pigeon"}, false},
+	}
+	for _, c := range cases {
+		if err := c.transport.Validate(); (err == nil) != c.ok {
+			t.Errorf("%s: got %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestUnicastSendsToSelfOnce(t *testing.T) {
+	transport := Transport{Mode: Unicast, Port: 16569, Peers: []string{"10.0.0.2:16569", "127.0.0.1:16569", "127.0.0.1:16570"}}
+	addrs, err := transport.unicastAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"127.0.0.1:16569", "10.0.0.2:16569", "127.0.0.1:16570"}
+	if len(addrs) != len(want) {
+		t.Fatalf("sends to %v, want %v", addrs, want)
+	}
+	for i, addr := range addrs {
+		if addr.(*net.UDPAddr).String() != want[i] {
+			t.Errorf("sends to %v, want %v", addrs, want)
+		}
+	}
+}
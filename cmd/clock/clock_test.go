@@ -0,0 +1,118 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func fired(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimerFiresOnAdvance(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	if _, ok := fired(timer.C()); ok {
+		t.Fatalf("timer fired early")
+	}
+	f.Advance(time.Millisecond)
+	if at, ok := fired(timer.C()); !ok || !at.Equal(epoch.Add(time.Second)) {
+		t.Fatalf("timer fired %v at %v, want at %v", ok, at, epoch.Add(time.Second))
+	}
+	if f.Pending() != 0 || timer.Stop() {
+		t.Errorf("fired timer still pending")
+	}
+
+	// Reset after firing starts it again from now
+	if timer.Reset(time.Second) {
+		t.Errorf("Reset of a fired timer reported it active")
+	}
+	f.Advance(time.Second)
+	if _, ok := fired(timer.C()); !ok {
+		t.Errorf("reset timer did not fire")
+	}
+}
+
+func TestFakeStoppedTimerDoesNotFire(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Fatalf("Stop of an active timer reported it inactive")
+	}
+	f.Advance(time.Minute)
+	if _, ok := fired(timer.C()); ok {
+		t.Errorf("stopped timer fired")
+	}
+}
+
+func TestFakeTickerRepeats(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(100 * time.Millisecond)
+	for i := 1; i <= 3; i++ {
+		f.Advance(100 * time.Millisecond)
+		at, ok := fired(ticker.C())
+		if want := epoch.Add(time.Duration(i) * 100 * time.Millisecond); !ok || !at.Equal(want) {
+			t.Fatalf("tick %d: %v at %v, want at %v", i, ok, at, want)
+		}
+	}
+
+	// Like a real ticker it drops ticks nobody has read
+	f.Advance(time.Second)
+	if _, ok := fired(ticker.C()); !ok {
+		t.Fatalf("no tick after a long advance")
+	}
+	if _, ok := fired(ticker.C()); ok {
+		t.Errorf("ticks piled up")
+	}
+
+	ticker.Stop()
+	f.Advance(time.Second)
+	if _, ok := fired(ticker.C()); ok || f.Pending() != 0 {
+		t.Errorf("stopped ticker still ticks")
+	}
+}
+
+func TestFakeFiresInDeadlineOrder(t *testing.T) {
+	f := NewFake(epoch)
+	var order []string
+	var seen []time.Time
+	f.AfterFunc(2*time.Second, func() { order = append(order, "second"); seen = append(seen, f.Now()) })
+	f.AfterFunc(time.Second, func() { order = append(order, "first"); seen = append(seen, f.Now()) })
+	f.AfterFunc(time.Minute, func() { order = append(order, "late") })
+
+	f.Advance(5 * time.Second)
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Fatalf("fired %v, want [first second]", order)
+	}
+	// Each callback sees the time it was due, and the clock ends at the end of the advance
+	if !seen[0].Equal(epoch.Add(time.Second)) || !seen[1].Equal(epoch.Add(2*time.Second)) {
+		t.Errorf("callbacks saw %v", seen)
+	}
+	if !f.Now().Equal(epoch.Add(5 * time.Second)) {
+		t.Errorf("clock at %v after advancing", f.Now())
+	}
+}
+
+func TestFakeCallbackCanSchedule(t *testing.T) {
+	f := NewFake(epoch)
+	count := 0
+	var again func()
+	again = func() {
+		count++
+		f.AfterFunc(time.Second, again)
+	}
+	f.AfterFunc(time.Second, again)
+	f.Advance(3 * time.Second)
+	if count != 3 {
+		t.Errorf("callback ran %d times in 3 s, want 3", count)
+	}
+}
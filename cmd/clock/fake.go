@@ -0,0 +1,169 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that only moves when Advance is called.
+// Timers and tickers that expire during Advance fire in deadline order,
+// and AfterFunc callbacks run on the goroutine calling Advance.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	when   time.Time
+	period time.Duration
+	ch     chan time.Time
+	fn     func()
+	active bool
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0, nil)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.add(d, d, nil)}
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(d, 0, fn)
+}
+
+// Advance moves the fake time forward by d, firing everything that expires on the way.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	f.mu.Unlock()
+
+	for {
+		f.mu.Lock()
+		next := f.nextExpired(end)
+		if next == nil {
+			f.now = end
+			f.mu.Unlock()
+			return
+		}
+		f.now = next.when
+		fn := next.fire()
+		f.mu.Unlock()
+
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// Pending returns the number of timers and tickers that have not fired or been stopped.
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (f *Fake) add(d time.Duration, period time.Duration, fn func()) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{
+		clock:  f,
+		when:   f.now.Add(d),
+		period: period,
+		ch:     make(chan time.Time, 1),
+		fn:     fn,
+	}
+	f.schedule(t)
+	return t
+}
+
+func (f *Fake) schedule(t *fakeTimer) {
+	t.active = true
+	f.waiters = append(f.waiters, t)
+	sort.SliceStable(f.waiters, func(i, j int) bool {
+		return f.waiters[i].when.Before(f.waiters[j].when)
+	})
+}
+
+func (f *Fake) unschedule(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+	t.active = false
+	for i, w := range f.waiters {
+		if w == t {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (f *Fake) nextExpired(end time.Time) *fakeTimer {
+	if len(f.waiters) == 0 || f.waiters[0].when.After(end) {
+		return nil
+	}
+	return f.waiters[0]
+}
+
+// fire must be called with the clock locked. It returns the callback to run, if any.
+func (t *fakeTimer) fire() func() {
+	f := t.clock
+	f.unschedule(t)
+	if t.fn != nil {
+		return t.fn
+	}
+	select {
+	case t.ch <- f.now:
+	default:
+	}
+	if t.period > 0 {
+		t.when = f.now.Add(t.period)
+		f.schedule(t)
+	}
+	return nil
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.unschedule(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.clock.unschedule(t)
+	t.when = t.clock.now.Add(d)
+	t.clock.schedule(t)
+	return wasActive
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
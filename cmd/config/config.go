@@ -3,9 +3,89 @@ package config
 const N_FLOORS = 4
 const N_BUTTONS = 3
 const DoorOpenDuration_s = 3.0
+// Time to travel between two floors, as the hall request assigner assumes
+const TravelDuration_s = 2.0
+// A car loaded with at least this much is full and passes hall calls
+const FullLoadKg = 800
+
+// Elevators only talk to elevators with the same cluster ID, so several
+// rigs can share a network and broadcast port
+const DefaultClusterID = "sanntids"
+
+// Used with -transport=multicast unless -mcast-group and -mcast-ttl are given
+const DefaultMulticastGroup = "239.255.30.3"
+const DefaultMulticastTTL = 1
+
+// The master resends an assignment after AckRetryMs, 2*AckRetryMs and so on until it
+// is acknowledged, and after AckDeadlineMs flags the elevator
+const AckRetryMs = 200
+const AckDeadlineMs = 1500
+// An elevator that has not served an order within the estimated time plus
+// CompletionSlackMs is flagged as well
+const CompletionSlackMs = 10000
+// Flagged elevators are left out of assignment for this long
+const FlaggedMs = 10000
+// An assigned order only moves to another elevator if that serves it at least this much sooner
+const ReassignMarginMs = 4000
+// Pressing a hall button twice within CancelDoublePressMs cancels the call
+const CancelDoublePressMs = 500
+// Number of hall call events each elevator keeps in its audit trail
+const AuditLogSize = 2000
 
 const TransmitTickerMs = 100
 const ElevatorTimeoutMs = 1000
+// Full snapshots double as heartbeats, so keep this well below ElevatorTimeoutMs
+const SnapshotIntervalMs = 400
+// Broadcasts older than this, or this far in the future, are treated as replays
+const MaxMessageAgeMs = 5000
+
+const LobbyFloor = 0
+// Floor all elevators go to during fire service recall
+const RecallFloor = 0
+const DefaultParkingStrategy = "none"
+
+// ParkingPeriod gives the floors idle elevators are sent to between FromHour
+// and ToHour (local time) with the schedule parking strategy
+type ParkingPeriod struct {
+    FromHour int
+    ToHour   int
+    Floors   []int
+}
+
+var ParkingSchedule = []ParkingPeriod{
+    {FromHour: 7, ToHour: 10, Floors: []int{LobbyFloor}},
+    {FromHour: 16, ToHour: 19, Floors: []int{N_FLOORS - 1}},
+}
+
+// The master detects the traffic mode from the hall calls of the last
+// TrafficWindowMs. A peak starts when it makes up TrafficPeakEnterShare of at
+// least TrafficMinCalls calls, and ends when it falls below TrafficPeakLeaveShare
+const TrafficWindowMs = 300000
+const TrafficMinCalls = 8
+const TrafficPeakEnterShare = 0.6
+const TrafficPeakLeaveShare = 0.4
+const DefaultTrafficSource = "calls"
+
+// TrafficPeriod gives the traffic mode (interfloor, up-peak or down-peak)
+// between FromHour and ToHour (local time) when the mode is taken from the schedule
+type TrafficPeriod struct {
+    FromHour int
+    ToHour   int
+    Mode     string
+}
+
+var TrafficSchedule = []TrafficPeriod{
+    {FromHour: 7, ToHour: 10, Mode: "up-peak"},
+    {FromHour: 16, ToHour: 19, Mode: "down-peak"},
+}
+
+// Destination calls from the same floor are given the same car if their
+// destinations are at most DestinationGroupFloors apart. Completed calls are
+// forgotten DestinationKeepMs after they were made. A new call is answered
+// when it has a car, or after DestinationReplyMs without one
+const DestinationGroupFloors = 1
+const DestinationKeepMs = 60000
+const DestinationReplyMs = 1000
 
 type ClearRequestVariant int
 const (
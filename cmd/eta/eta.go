@@ -0,0 +1,121 @@
+package eta
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/localElevator/elevator"
+	"sanntids/cmd/localElevator/fsm"
+	"sanntids/cmd/structs"
+	"time"
+)
+
+// NotServed is the service time of a request the elevator does not have.
+const NotServed time.Duration = -1
+
+// ServiceTimes simulates an elevator in the given state serving its cab
+// calls and hallRequests by running it through the FSM core, with floors
+// reached and doors closed when the hall request assigner expects them. It
+// returns how long from now each request is cleared.
+func ServiceTimes(state structs.HRAElevState, hallRequests [config.N_FLOORS][2]bool) [config.N_FLOORS][config.N_BUTTONS]time.Duration {
+	var times [config.N_FLOORS][config.N_BUTTONS]time.Duration
+	for floor := range times {
+		for btn := range times[floor] {
+			times[floor][btn] = NotServed
+		}
+	}
+
+	e := fromState(state, hallRequests)
+	travel := secondsToDuration(config.TravelDuration_s)
+	doorOpen := secondsToDuration(config.DoorOpenDuration_s)
+
+	// A moving elevator is taken to be halfway to the next floor, an open door halfway through
+	var elapsed time.Duration
+	switch e.Behaviour {
+	case elevator.EB_Moving:
+		elapsed = -travel / 2
+	case elevator.EB_DoorOpen:
+		elapsed = -doorOpen / 2
+	}
+	s, actions := fsm.Transition(fsm.InitialState(e), fsm.Event{Kind: fsm.EV_RequestsUpdate, Requests: e.Requests})
+
+	// Every call is served within a few sweeps of the shaft
+	for step := 0; step < 8*config.N_FLOORS; step++ {
+		if doorTimerStarted(actions) {
+			// The door opens now, or is kept open for a request at the floor
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			for floor := range times {
+				for btn := range times[floor] {
+					if s.Elevator.Cleared[floor][btn] {
+						times[floor][btn] = elapsed
+					}
+				}
+			}
+		}
+
+		el := s.Elevator
+		switch el.Behaviour {
+		case elevator.EB_DoorOpen:
+			elapsed += doorOpen
+			s, actions = fsm.Transition(s, fsm.Event{Kind: fsm.EV_DoorTimeout})
+		case elevator.EB_Moving:
+			next := el.Floor + int(el.MotorDirection)
+			if next < 0 || next >= config.N_FLOORS {
+				return times
+			}
+			elapsed += travel
+			s, actions = fsm.Transition(s, fsm.Event{Kind: fsm.EV_FloorArrival, Floor: next})
+		default:
+			return times
+		}
+	}
+
+	return times
+}
+
+func doorTimerStarted(actions []fsm.Action) bool {
+	for _, a := range actions {
+		if a.Kind == fsm.A_StartDoorTimer {
+			return true
+		}
+	}
+	return false
+}
+
+func fromState(state structs.HRAElevState, hallRequests [config.N_FLOORS][2]bool) elevator.Elevator {
+	var e elevator.Elevator
+	e.Floor = state.Floor
+	e.Config.ClearRequestVariant = config.CV_All
+	e.Config.DoorOpenDuration_s = config.DoorOpenDuration_s
+
+	switch state.Behavior {
+	case "moving":
+		e.Behaviour = elevator.EB_Moving
+	case "doorOpen":
+		e.Behaviour = elevator.EB_DoorOpen
+	default:
+		e.Behaviour = elevator.EB_Idle
+	}
+	switch state.Direction {
+	case "up":
+		e.MotorDirection = elevio.MD_Up
+	case "down":
+		e.MotorDirection = elevio.MD_Down
+	default:
+		e.MotorDirection = elevio.MD_Stop
+	}
+
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		e.Requests[floor][elevio.BT_HallUp] = hallRequests[floor][elevio.BT_HallUp]
+		e.Requests[floor][elevio.BT_HallDown] = hallRequests[floor][elevio.BT_HallDown]
+		if floor < len(state.CabRequests) {
+			e.Requests[floor][elevio.BT_Cab] = state.CabRequests[floor]
+		}
+	}
+	return e
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,68 @@
+package eta
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestServiceTimes(t *testing.T) {
+	travel := secondsToDuration(config.TravelDuration_s)
+	doorOpen := secondsToDuration(config.DoorOpenDuration_s)
+
+	var hall [config.N_FLOORS][2]bool
+	hall[0][elevio.BT_HallUp] = true
+	hall[2][elevio.BT_HallDown] = true
+	times := ServiceTimes(structs.IdleAt(0), hall)
+
+	if got := times[0][elevio.BT_HallUp]; got != 0 {
+		t.Errorf("call at the current floor served after %v, want 0", got)
+	}
+	if got, want := times[2][elevio.BT_HallDown], doorOpen+2*travel; got != want {
+		t.Errorf("call two floors up served after %v, want %v", got, want)
+	}
+	if got := times[3][elevio.BT_HallDown]; got != NotServed {
+		t.Errorf("call that was not made served after %v", got)
+	}
+}
+
+func TestServiceTimesMovingWithCabCall(t *testing.T) {
+	travel := secondsToDuration(config.TravelDuration_s)
+
+	state := structs.IdleAt(1)
+	state.Behavior = "moving"
+	state.Direction = "up"
+	state.CabRequests[3] = true
+	var hall [config.N_FLOORS][2]bool
+	hall[0][elevio.BT_HallUp] = true
+	times := ServiceTimes(state, hall)
+
+	if got, want := times[3][elevio.BT_Cab], travel/2+travel; got != want {
+		t.Errorf("cab call served after %v, want %v", got, want)
+	}
+	if got := times[0][elevio.BT_HallUp]; got <= times[3][elevio.BT_Cab] || got > time.Minute {
+		t.Errorf("call behind the car served after %v", got)
+	}
+}
+
+func TestServiceTimesDoorOpen(t *testing.T) {
+	travel := secondsToDuration(config.TravelDuration_s)
+	doorOpen := secondsToDuration(config.DoorOpenDuration_s)
+
+	state := structs.IdleAt(1)
+	state.Behavior = "doorOpen"
+	var hall [config.N_FLOORS][2]bool
+	hall[1][elevio.BT_HallUp] = true
+	hall[2][elevio.BT_HallUp] = true
+	times := ServiceTimes(state, hall)
+
+	// The call at the open door is taken at once and keeps the door open for as long again
+	if got := times[1][elevio.BT_HallUp]; got != 0 {
+		t.Errorf("call at the open door served after %v, want 0", got)
+	}
+	if got, want := times[2][elevio.BT_HallUp], doorOpen+travel; got != want {
+		t.Errorf("call one floor up served after %v, want %v", got, want)
+	}
+}
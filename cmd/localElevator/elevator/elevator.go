@@ -1,6 +1,7 @@
 package elevator
 import (
 	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
 	"Driver-go/elevio"
 	"encoding/json"
 	"fmt"
@@ -67,6 +68,10 @@ type Elevator struct {
     Behaviour ElevatorBehaviour
     Obstruction bool
     Stop bool
+    Maintenance bool
+    LoadKg int
+    // HallPriority is the priority of each hall request
+    HallPriority [config.N_FLOORS][2]structs.Priority
 
     Config struct {
         ClearRequestVariant config.ClearRequestVariant
@@ -75,6 +80,11 @@ type Elevator struct {
 }
 
 
+// IsFull reports whether the load sensor says no one else can get on.
+func IsFull(e Elevator) bool {
+    return e.LoadKg >= config.FullLoadKg
+}
+
 func ElevatorInit() Elevator {
     var zeros [config.N_FLOORS][config.N_BUTTONS]bool
 
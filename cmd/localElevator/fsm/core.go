@@ -0,0 +1,466 @@
+package fsm
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/localElevator/elevator"
+	"sanntids/cmd/localElevator/requests"
+	"sanntids/cmd/structs"
+	"time"
+)
+
+// A moving elevator that has not reached a new floor within this time is reported as stopped
+const stallTimeout = 4 * time.Second
+
+// State is everything the FSM core needs to compute the next transition.
+// ParkFloor is where the master wants the elevator to wait while it has no
+// requests, -1 if anywhere, and Parking is set while it is on its way there.
+// In maintenance the elevator parks at MaintenanceFloor instead, if it is
+// set, and HoldingDoor is set while it waits there with the door open.
+// During fire service recall it goes to RecallFloor the same way, ignoring
+// all requests.
+type State struct {
+	Elevator         elevator.Elevator
+	LastMovingFloor  int
+	MovingStartTime  time.Time
+	ParkFloor        int
+	Parking          bool
+	MaintenanceFloor int
+	HoldingDoor      bool
+	Recall           bool
+	RecallFloor      int
+}
+
+type EventKind int
+
+const (
+	EV_RequestsUpdate EventKind = iota
+	EV_FloorArrival
+	EV_DoorTimeout
+	EV_Obstruction
+	EV_ParkingUpdate
+	EV_Maintenance
+	EV_Recall
+	EV_Load
+	EV_Priority
+)
+
+// Event is an input to the FSM. Only the fields relevant for Kind are used,
+// Now is the time the event was observed and is needed for stall detection.
+type Event struct {
+	Kind        EventKind
+	Requests    [config.N_FLOORS][config.N_BUTTONS]bool
+	Floor       int
+	Obstruction bool
+	Maintenance bool
+	Recall      bool
+	LoadKg      int
+	Priorities  [config.N_FLOORS][2]structs.Priority
+	Now         time.Time
+}
+
+type ActionKind int
+
+const (
+	A_SetMotor ActionKind = iota
+	A_SetDoorLamp
+	A_SetCabLamp
+	A_SetFloorIndicator
+	A_StartDoorTimer
+	A_PauseDoorTimer
+	A_ResumeDoorTimer
+)
+
+// Action is a side effect requested by the core, carried out by the driver loop.
+type Action struct {
+	Kind  ActionKind
+	Motor elevio.MotorDirection
+	Floor int
+	Value bool
+}
+
+func InitialState(e elevator.Elevator) State {
+	return State{
+		Elevator:         e,
+		LastMovingFloor:  -1,
+		ParkFloor:        -1,
+		MaintenanceFloor: -1,
+	}
+}
+
+// Transition is the pure elevator state machine: it never touches the
+// hardware or timers, it only returns the new state and the actions to perform.
+func Transition(s State, ev Event) (State, []Action) {
+	switch ev.Kind {
+	case EV_RequestsUpdate:
+		return onRequestsUpdate(s, ev.Requests, ev.Now)
+	case EV_FloorArrival:
+		return onFloorArrival(s, ev.Floor, ev.Now)
+	case EV_DoorTimeout:
+		return onDoorTimeout(s, ev.Now)
+	case EV_Obstruction:
+		return onObstruction(s, ev.Obstruction)
+	case EV_ParkingUpdate:
+		return onParkingUpdate(s, ev.Floor, ev.Now)
+	case EV_Maintenance:
+		return onMaintenance(s, ev.Maintenance, ev.Floor, ev.Now)
+	case EV_Recall:
+		return onRecall(s, ev.Recall, ev.Floor, ev.Now)
+	case EV_Load:
+		s.Elevator.LoadKg = ev.LoadKg
+		return s, nil
+	case EV_Priority:
+		s.Elevator.HallPriority = ev.Priorities
+		return s, nil
+	default:
+		return s, nil
+	}
+}
+
+func cabLightActions(e elevator.Elevator) []Action {
+	var actions []Action
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		actions = append(actions, Action{Kind: A_SetCabLamp, Floor: floor, Value: e.Requests[floor][elevio.BT_Cab]})
+	}
+	return actions
+}
+
+func onRequestsUpdate(s State, newRequests [config.N_FLOORS][config.N_BUTTONS]bool, now time.Time) (State, []Action) {
+	if s.Recall {
+		return s, nil
+	}
+	var actions []Action
+	el := &s.Elevator
+	if el.Maintenance {
+		newRequests = cabRequestsOnly(newRequests)
+	}
+	el.Requests = newRequests
+
+	switch el.Behaviour {
+	case elevator.EB_DoorOpen:
+		s.MovingStartTime = now
+		var zeros [config.N_FLOORS][config.N_BUTTONS]bool
+		el.Cleared = zeros
+		restartDoor := false
+		for floor := 0; floor < config.N_FLOORS; floor++ {
+			for btnType := 0; btnType < config.N_BUTTONS; btnType++ {
+				if newRequests[floor][btnType] &&
+					requests.RequestsShouldClearImmediately(*el, floor, elevio.ButtonType(btnType)) {
+					el.Cleared[floor][btnType] = true
+					el.Requests[floor][btnType] = false
+					restartDoor = true
+				}
+			}
+		}
+		if restartDoor || (s.HoldingDoor && hasRequests(*el)) {
+			s.HoldingDoor = false
+			actions = append(actions, Action{Kind: A_StartDoorTimer})
+		}
+
+	case elevator.EB_Moving:
+		if s.LastMovingFloor == -1 {
+			s.LastMovingFloor = el.Floor
+			s.MovingStartTime = now
+		}
+		if s.Parking && hasRequests(*el) {
+			// A real call cancels parking at once, turning around if it is behind the car
+			s.Parking = false
+			pair := requests.RequestsChooseDirection(*el)
+			if pair.Behaviour != elevator.EB_Idle && pair.MotorDirection != elevio.MD_Stop && pair.MotorDirection != el.MotorDirection {
+				el.MotorDirection = pair.MotorDirection
+				actions = append(actions, Action{Kind: A_SetMotor, Motor: el.MotorDirection})
+			}
+		}
+
+	case elevator.EB_Idle:
+		s.LastMovingFloor = -1
+		s.MovingStartTime = now
+		pair := requests.RequestsChooseDirection(*el)
+		el.MotorDirection = pair.MotorDirection
+		el.Behaviour = pair.Behaviour
+		switch pair.Behaviour {
+		case elevator.EB_DoorOpen:
+			actions = append(actions,
+				Action{Kind: A_SetDoorLamp, Value: true},
+				Action{Kind: A_StartDoorTimer})
+			el.Cleared = requests.RequestsGetClearedAtCurrentFloor(*el)
+			*el = requests.RequestsClearAtCurrentFloor(*el)
+
+		case elevator.EB_Moving:
+			actions = append(actions, Action{Kind: A_SetMotor, Motor: el.MotorDirection})
+
+		case elevator.EB_Idle:
+			var parkActions []Action
+			s, parkActions = startParking(s, now)
+			actions = append(actions, parkActions...)
+		}
+	}
+
+	actions = append(actions, cabLightActions(*el)...)
+
+	el.Stop = el.Behaviour == elevator.EB_Moving &&
+		s.LastMovingFloor == el.Floor &&
+		now.Sub(s.MovingStartTime) > stallTimeout
+
+	return s, actions
+}
+
+func onFloorArrival(s State, newFloor int, now time.Time) (State, []Action) {
+	el := &s.Elevator
+
+	// Update the last moving floor when we arrive at a new floor
+	s.LastMovingFloor = newFloor
+	s.MovingStartTime = now
+
+	el.Floor = newFloor
+	actions := []Action{{Kind: A_SetFloorIndicator, Floor: newFloor}}
+
+	if s.Parking {
+		if !hasRequests(*el) {
+			var parkActions []Action
+			s, parkActions = parkingStep(s)
+			return s, append(actions, parkActions...)
+		}
+		s.Parking = false
+	}
+
+	switch el.Behaviour {
+	case elevator.EB_Moving:
+		if requests.RequestsShouldStop(*el) {
+			actions = append(actions,
+				Action{Kind: A_SetMotor, Motor: elevio.MD_Stop},
+				Action{Kind: A_SetDoorLamp, Value: true})
+			el.Cleared = requests.RequestsGetClearedAtCurrentFloor(*el)
+			*el = requests.RequestsClearAtCurrentFloor(*el)
+			actions = append(actions, Action{Kind: A_StartDoorTimer})
+			actions = append(actions, cabLightActions(*el)...)
+			el.Behaviour = elevator.EB_DoorOpen
+		}
+	default:
+	}
+
+	return s, actions
+}
+
+func onDoorTimeout(s State, now time.Time) (State, []Action) {
+	if s.HoldingDoor {
+		return s, nil
+	}
+	var actions []Action
+	el := &s.Elevator
+
+	switch el.Behaviour {
+	case elevator.EB_DoorOpen:
+		pair := requests.RequestsChooseDirection(*el)
+		el.MotorDirection = pair.MotorDirection
+		el.Behaviour = pair.Behaviour
+
+		switch el.Behaviour {
+		case elevator.EB_DoorOpen:
+			actions = append(actions, Action{Kind: A_StartDoorTimer})
+			el.Cleared = requests.RequestsGetClearedAtCurrentFloor(*el)
+			*el = requests.RequestsClearAtCurrentFloor(*el)
+			actions = append(actions, cabLightActions(*el)...)
+
+		case elevator.EB_Moving, elevator.EB_Idle:
+			actions = append(actions,
+				Action{Kind: A_SetDoorLamp, Value: false},
+				Action{Kind: A_SetMotor, Motor: el.MotorDirection})
+			if el.Behaviour == elevator.EB_Idle {
+				var parkActions []Action
+				s, parkActions = startParking(s, now)
+				actions = append(actions, parkActions...)
+			}
+		}
+
+	default:
+	}
+
+	return s, actions
+}
+
+func onObstruction(s State, obstruction bool) (State, []Action) {
+	var actions []Action
+	s.Elevator.Obstruction = obstruction
+	switch {
+	case obstruction:
+		actions = append(actions, Action{Kind: A_PauseDoorTimer})
+	case !obstruction:
+		actions = append(actions, Action{Kind: A_ResumeDoorTimer})
+		if s.Elevator.Behaviour == elevator.EB_DoorOpen && !s.HoldingDoor {
+			actions = append(actions, Action{Kind: A_StartDoorTimer})
+		}
+	}
+	return s, actions
+}
+
+func onParkingUpdate(s State, floor int, now time.Time) (State, []Action) {
+	s.ParkFloor = floor
+	return startParking(s, now)
+}
+
+// onMaintenance takes the elevator out of service or puts it back. Hall
+// calls are taken away by the order manager, and ignored here until it has,
+// so an elevator in maintenance finishes the stop it is making and its cab
+// calls and then parks at floor with the door open.
+func onMaintenance(s State, on bool, floor int, now time.Time) (State, []Action) {
+	s.Elevator.Maintenance = on
+	s.MaintenanceFloor = floor
+	if on {
+		s.Elevator.Requests = cabRequestsOnly(s.Elevator.Requests)
+	}
+	if s.Recall {
+		return s, nil
+	}
+	if !on && s.HoldingDoor {
+		// Close the door the usual way
+		s.HoldingDoor = false
+		return s, []Action{{Kind: A_StartDoorTimer}}
+	}
+	if s.HoldingDoor && floor != s.Elevator.Floor {
+		s.HoldingDoor = false
+		s.Elevator.Behaviour = elevator.EB_Idle
+		var parkActions []Action
+		s, parkActions = startParking(s, now)
+		return s, append([]Action{{Kind: A_SetDoorLamp, Value: false}}, parkActions...)
+	}
+	return startParking(s, now)
+}
+
+// onRecall starts or resets fire service recall. All requests are
+// cancelled, and the elevator closes its door and goes to the recall floor
+// without stopping, turning around if it is moving away from it.
+func onRecall(s State, active bool, floor int, now time.Time) (State, []Action) {
+	el := &s.Elevator
+	if active == s.Recall && (!active || floor == s.RecallFloor) {
+		return s, nil
+	}
+	s.Recall = active
+	s.RecallFloor = floor
+	if !active {
+		if !s.HoldingDoor {
+			return s, nil
+		}
+		s.HoldingDoor = false
+		return s, []Action{{Kind: A_StartDoorTimer}}
+	}
+
+	var zeros [config.N_FLOORS][config.N_BUTTONS]bool
+	el.Requests = zeros
+	el.Cleared = zeros
+	actions := cabLightActions(*el)
+
+	switch el.Behaviour {
+	case elevator.EB_DoorOpen:
+		if s.HoldingDoor && el.Floor == floor {
+			return s, actions
+		}
+		s.HoldingDoor = false
+		el.Behaviour = elevator.EB_Idle
+		actions = append(actions, Action{Kind: A_SetDoorLamp, Value: false})
+
+	case elevator.EB_Moving:
+		if el.Floor == floor {
+			// Between the recall floor and the next one, so head back
+			el.MotorDirection = -el.MotorDirection
+			s.Parking = true
+			return s, append(actions, Action{Kind: A_SetMotor, Motor: el.MotorDirection})
+		}
+		var parkActions []Action
+		s, parkActions = parkingStep(s)
+		return s, append(actions, parkActions...)
+	}
+
+	var parkActions []Action
+	s, parkActions = startParking(s, now)
+	return s, append(actions, parkActions...)
+}
+
+// parkTarget is the floor the elevator should wait at, -1 if anywhere.
+func parkTarget(s State) int {
+	if s.Recall {
+		return s.RecallFloor
+	}
+	if s.Elevator.Maintenance {
+		return s.MaintenanceFloor
+	}
+	return s.ParkFloor
+}
+
+// startParking sends an idle elevator without requests to its parking floor.
+func startParking(s State, now time.Time) (State, []Action) {
+	el := &s.Elevator
+	target := parkTarget(s)
+	if el.Behaviour != elevator.EB_Idle || hasRequests(*el) || target < 0 || target >= config.N_FLOORS {
+		return s, nil
+	}
+	if target == el.Floor {
+		return holdDoor(s)
+	}
+	s.LastMovingFloor = el.Floor
+	s.MovingStartTime = now
+	return parkingStep(s)
+}
+
+// parkingStep is taken at every floor on the way to the parking floor. The
+// elevator stops there with the door closed, or wherever it is if the
+// parking floor has been taken away.
+func parkingStep(s State) (State, []Action) {
+	el := &s.Elevator
+	target := parkTarget(s)
+	if target < 0 || target >= config.N_FLOORS || target == el.Floor {
+		s.Parking = false
+		el.MotorDirection = elevio.MD_Stop
+		el.Behaviour = elevator.EB_Idle
+		actions := []Action{{Kind: A_SetMotor, Motor: elevio.MD_Stop}}
+		if target == el.Floor {
+			var holdActions []Action
+			s, holdActions = holdDoor(s)
+			return s, append(actions, holdActions...)
+		}
+		return s, actions
+	}
+
+	var dir elevio.MotorDirection = elevio.MD_Down
+	if target > el.Floor {
+		dir = elevio.MD_Up
+	}
+	s.Parking = true
+	if el.Behaviour == elevator.EB_Moving && el.MotorDirection == dir {
+		return s, nil
+	}
+	el.MotorDirection = dir
+	el.Behaviour = elevator.EB_Moving
+	return s, []Action{{Kind: A_SetMotor, Motor: dir}}
+}
+
+// holdDoor opens the door of an elevator in maintenance or recall at its
+// parking floor and keeps it open, without the door timer, until it gets a
+// request or leaves maintenance or recall.
+func holdDoor(s State) (State, []Action) {
+	if !(s.Elevator.Maintenance || s.Recall) || s.HoldingDoor {
+		return s, nil
+	}
+	s.HoldingDoor = true
+	s.Elevator.Behaviour = elevator.EB_DoorOpen
+	return s, []Action{{Kind: A_SetDoorLamp, Value: true}}
+}
+
+func cabRequestsOnly(r [config.N_FLOORS][config.N_BUTTONS]bool) [config.N_FLOORS][config.N_BUTTONS]bool {
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		r[floor][elevio.BT_HallUp] = false
+		r[floor][elevio.BT_HallDown] = false
+	}
+	return r
+}
+
+func hasRequests(e elevator.Elevator) bool {
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		for btn := 0; btn < config.N_BUTTONS; btn++ {
+			if e.Requests[floor][btn] {
+				return true
+			}
+		}
+	}
+	return false
+}
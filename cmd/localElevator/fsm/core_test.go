@@ -0,0 +1,638 @@
+package fsm
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/localElevator/elevator"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type requestMatrix = [config.N_FLOORS][config.N_BUTTONS]bool
+
+// at returns the state of an elevator at floor with the given behaviour and direction.
+func at(floor int, behaviour elevator.ElevatorBehaviour, dir elevio.MotorDirection) State {
+	var e elevator.Elevator
+	e.Floor = floor
+	e.Behaviour = behaviour
+	e.MotorDirection = dir
+	e.Config.ClearRequestVariant = config.CV_All
+	e.Config.DoorOpenDuration_s = config.DoorOpenDuration_s
+	return InitialState(e)
+}
+
+func with(s State, requests requestMatrix) State {
+	s.Elevator.Requests = requests
+	return s
+}
+
+func request(floor int, btn elevio.ButtonType) requestMatrix {
+	var r requestMatrix
+	r[floor][btn] = true
+	return r
+}
+
+func merge(a requestMatrix, b requestMatrix) requestMatrix {
+	for floor := range a {
+		for btn := range a[floor] {
+			a[floor][btn] = a[floor][btn] || b[floor][btn]
+		}
+	}
+	return a
+}
+
+func motor(dir elevio.MotorDirection) Action {
+	return Action{Kind: A_SetMotor, Motor: dir}
+}
+
+var (
+	doorOpened  = Action{Kind: A_SetDoorLamp, Value: true}
+	doorClosed  = Action{Kind: A_SetDoorLamp, Value: false}
+	doorTimer   = Action{Kind: A_StartDoorTimer}
+	pauseTimer  = Action{Kind: A_PauseDoorTimer}
+	resumeTimer = Action{Kind: A_ResumeDoorTimer}
+)
+
+type coreCase struct {
+	name  string
+	state State
+	event Event
+	// behaviour and dir are the elevator's afterwards
+	behaviour elevator.ElevatorBehaviour
+	dir       elevio.MotorDirection
+	// actions must all be returned, and no action of a kind in never
+	actions []Action
+	never   []ActionKind
+	check   func(t *testing.T, s State)
+}
+
+func runCoreCases(t *testing.T, cases []coreCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.event.Now.IsZero() {
+				c.event.Now = epoch
+			}
+			s, actions := Transition(c.state, c.event)
+			if s.Elevator.Behaviour != c.behaviour || s.Elevator.MotorDirection != c.dir {
+				t.Errorf("ended %v going %v, want %v going %v", s.Elevator.Behaviour, s.Elevator.MotorDirection, c.behaviour, c.dir)
+			}
+			for _, want := range c.actions {
+				if !hasAction(actions, want) {
+					t.Errorf("no %+v among %+v", want, actions)
+				}
+			}
+			for _, kind := range c.never {
+				for _, a := range actions {
+					if a.Kind == kind {
+						t.Errorf("unexpected %+v", a)
+					}
+				}
+			}
+			if c.check != nil {
+				c.check(t, s)
+			}
+		})
+	}
+}
+
+func hasAction(actions []Action, want Action) bool {
+	for _, a := range actions {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTransition(t *testing.T) {
+	runCoreCases(t, []coreCase{
+		{
+			name:      "idle request above starts moving up",
+			state:     at(0, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(2, elevio.BT_HallDown)},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			actions: []Action{motor(elevio.MD_Up)},
+			never:   []ActionKind{A_SetDoorLamp, A_StartDoorTimer},
+		},
+		{
+			name:      "idle request at the floor opens the door",
+			state:     at(1, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(1, elevio.BT_Cab)},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{doorOpened, doorTimer, {Kind: A_SetCabLamp, Floor: 1, Value: false}},
+			never:   []ActionKind{A_SetMotor},
+			check: func(t *testing.T, s State) {
+				if s.Elevator.Requests[1][elevio.BT_Cab] || !s.Elevator.Cleared[1][elevio.BT_Cab] {
+					t.Errorf("cab call not cleared: %v", s.Elevator.Requests)
+				}
+			},
+		},
+		{
+			name:      "idle without requests stays put",
+			state:     at(1, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_RequestsUpdate},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			never: []ActionKind{A_SetMotor, A_SetDoorLamp, A_StartDoorTimer},
+		},
+		{
+			name:      "moving request is only taken on",
+			state:     at(1, elevator.EB_Moving, elevio.MD_Up),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(3, elevio.BT_Cab)},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			actions: []Action{{Kind: A_SetCabLamp, Floor: 3, Value: true}},
+			never:   []ActionKind{A_SetMotor, A_SetDoorLamp},
+		},
+		{
+			name:      "arrival at a requested floor stops and opens the door",
+			state:     with(at(1, elevator.EB_Moving, elevio.MD_Up), request(2, elevio.BT_Cab)),
+			event:     Event{Kind: EV_FloorArrival, Floor: 2},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Up,
+			actions: []Action{{Kind: A_SetFloorIndicator, Floor: 2}, motor(elevio.MD_Stop), doorOpened, doorTimer},
+			check: func(t *testing.T, s State) {
+				if s.Elevator.Floor != 2 || s.Elevator.Requests[2][elevio.BT_Cab] {
+					t.Errorf("at floor %d with requests %v", s.Elevator.Floor, s.Elevator.Requests)
+				}
+			},
+		},
+		{
+			name:      "arrival passes a floor with a call the other way",
+			state:     with(at(0, elevator.EB_Moving, elevio.MD_Up), merge(request(1, elevio.BT_HallDown), request(3, elevio.BT_Cab))),
+			event:     Event{Kind: EV_FloorArrival, Floor: 1},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			actions: []Action{{Kind: A_SetFloorIndicator, Floor: 1}},
+			never:   []ActionKind{A_SetMotor, A_SetDoorLamp, A_StartDoorTimer},
+		},
+		{
+			name:      "door timeout leaves for a request below",
+			state:     with(at(2, elevator.EB_DoorOpen, elevio.MD_Stop), request(0, elevio.BT_Cab)),
+			event:     Event{Kind: EV_DoorTimeout},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Down,
+			actions: []Action{doorClosed, motor(elevio.MD_Down)},
+		},
+		{
+			name:      "door timeout without requests goes idle",
+			state:     at(2, elevator.EB_DoorOpen, elevio.MD_Stop),
+			event:     Event{Kind: EV_DoorTimeout},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			actions: []Action{doorClosed, motor(elevio.MD_Stop)},
+		},
+		{
+			name:      "door timeout reopens for a call the other way at the floor",
+			state:     with(at(2, elevator.EB_DoorOpen, elevio.MD_Stop), request(2, elevio.BT_HallDown)),
+			event:     Event{Kind: EV_DoorTimeout},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{doorTimer},
+			never:   []ActionKind{A_SetMotor, A_SetDoorLamp},
+		},
+		{
+			name:      "request at an open door is cleared and restarts the timer",
+			state:     at(2, elevator.EB_DoorOpen, elevio.MD_Stop),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(2, elevio.BT_Cab)},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{doorTimer},
+			check: func(t *testing.T, s State) {
+				if s.Elevator.Requests[2][elevio.BT_Cab] || !s.Elevator.Cleared[2][elevio.BT_Cab] {
+					t.Errorf("request not cleared at the open door: %v", s.Elevator.Requests)
+				}
+			},
+		},
+		{
+			name:      "obstruction pauses the door timer",
+			state:     at(2, elevator.EB_DoorOpen, elevio.MD_Stop),
+			event:     Event{Kind: EV_Obstruction, Obstruction: true},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{pauseTimer},
+			never:   []ActionKind{A_StartDoorTimer, A_SetDoorLamp},
+			check: func(t *testing.T, s State) {
+				if !s.Elevator.Obstruction {
+					t.Errorf("obstruction not recorded")
+				}
+			},
+		},
+		{
+			name:      "obstruction cleared restarts the door timer",
+			state:     at(2, elevator.EB_DoorOpen, elevio.MD_Stop),
+			event:     Event{Kind: EV_Obstruction},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{resumeTimer, doorTimer},
+		},
+		{
+			name:      "obstruction cleared with the door shut only resumes",
+			state:     at(2, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_Obstruction},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			actions: []Action{resumeTimer},
+			never:   []ActionKind{A_StartDoorTimer},
+		},
+		{
+			name: "moving without reaching a floor is reported as stopped",
+			state: func() State {
+				s := with(at(1, elevator.EB_Moving, elevio.MD_Up), request(3, elevio.BT_Cab))
+				s.LastMovingFloor = 1
+				s.MovingStartTime = epoch.Add(-stallTimeout - time.Second)
+				return s
+			}(),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(3, elevio.BT_Cab)},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			check: func(t *testing.T, s State) {
+				if !s.Elevator.Stop {
+					t.Errorf("stalled elevator not reported as stopped")
+				}
+			},
+		},
+		{
+			name: "arriving at a floor clears the stop",
+			state: func() State {
+				s := with(at(1, elevator.EB_Moving, elevio.MD_Up), request(3, elevio.BT_Cab))
+				s.LastMovingFloor = 1
+				s.MovingStartTime = epoch.Add(-stallTimeout - time.Second)
+				s, _ = Transition(s, Event{Kind: EV_FloorArrival, Floor: 2, Now: epoch})
+				return s
+			}(),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(3, elevio.BT_Cab), Now: epoch.Add(time.Second)},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			check: func(t *testing.T, s State) {
+				if s.Elevator.Stop {
+					t.Errorf("moving elevator reported as stopped")
+				}
+			},
+		},
+		{
+			name:      "load is recorded",
+			state:     at(0, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_Load, LoadKg: 300},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			check: func(t *testing.T, s State) {
+				if s.Elevator.LoadKg != 300 {
+					t.Errorf("load is %d", s.Elevator.LoadKg)
+				}
+			},
+		},
+	})
+}
+
+func TestParking(t *testing.T) {
+	parking := func(floor int, dir elevio.MotorDirection, park int) State {
+		s := at(floor, elevator.EB_Moving, dir)
+		s.ParkFloor = park
+		s.Parking = true
+		return s
+	}
+	runCoreCases(t, []coreCase{
+		{
+			name:      "idle goes to the park floor",
+			state:     at(0, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_ParkingUpdate, Floor: 2},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			actions: []Action{motor(elevio.MD_Up)},
+			never:   []ActionKind{A_SetDoorLamp},
+			check: func(t *testing.T, s State) {
+				if !s.Parking || s.ParkFloor != 2 {
+					t.Errorf("not parking at 2: %+v", s)
+				}
+			},
+		},
+		{
+			name:      "busy elevator does not park",
+			state:     with(at(0, elevator.EB_DoorOpen, elevio.MD_Stop), request(3, elevio.BT_Cab)),
+			event:     Event{Kind: EV_ParkingUpdate, Floor: 2},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			never: []ActionKind{A_SetMotor},
+			check: func(t *testing.T, s State) {
+				if s.Parking {
+					t.Errorf("parking with the door open")
+				}
+			},
+		},
+		{
+			name:      "already at the park floor stays put",
+			state:     at(2, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_ParkingUpdate, Floor: 2},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			never: []ActionKind{A_SetMotor, A_SetDoorLamp},
+		},
+		{
+			name:      "arrival at the park floor stops with the door shut",
+			state:     parking(1, elevio.MD_Up, 2),
+			event:     Event{Kind: EV_FloorArrival, Floor: 2},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			actions: []Action{motor(elevio.MD_Stop)},
+			never:   []ActionKind{A_SetDoorLamp, A_StartDoorTimer},
+			check: func(t *testing.T, s State) {
+				if s.Parking {
+					t.Errorf("still parking after arriving")
+				}
+			},
+		},
+		{
+			name:      "arrival on the way to the park floor keeps going",
+			state:     parking(0, elevio.MD_Up, 3),
+			event:     Event{Kind: EV_FloorArrival, Floor: 1},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			never: []ActionKind{A_SetMotor, A_SetDoorLamp},
+		},
+		{
+			name:      "request behind the car preempts parking",
+			state:     parking(1, elevio.MD_Up, 3),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(0, elevio.BT_HallUp)},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Down,
+			actions: []Action{motor(elevio.MD_Down)},
+			check: func(t *testing.T, s State) {
+				if s.Parking {
+					t.Errorf("still parking with a request")
+				}
+			},
+		},
+		{
+			name:      "request on the way stops the parking car",
+			state:     with(parking(0, elevio.MD_Up, 3), request(1, elevio.BT_Cab)),
+			event:     Event{Kind: EV_FloorArrival, Floor: 1},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Up,
+			actions: []Action{motor(elevio.MD_Stop), doorOpened, doorTimer},
+		},
+		{
+			name:      "park floor taken away stops at the next floor",
+			state:     parking(0, elevio.MD_Up, -1),
+			event:     Event{Kind: EV_FloorArrival, Floor: 1},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			actions: []Action{motor(elevio.MD_Stop)},
+			never:   []ActionKind{A_SetDoorLamp},
+		},
+	})
+}
+
+func TestMaintenance(t *testing.T) {
+	inMaintenance := func(s State, floor int) State {
+		s.Elevator.Maintenance = true
+		s.MaintenanceFloor = floor
+		return s
+	}
+	holding := func(floor int) State {
+		s := inMaintenance(at(floor, elevator.EB_DoorOpen, elevio.MD_Stop), floor)
+		s.HoldingDoor = true
+		return s
+	}
+	runCoreCases(t, []coreCase{
+		{
+			name:      "hall requests are ignored",
+			state:     inMaintenance(at(0, elevator.EB_Idle, elevio.MD_Stop), -1),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(2, elevio.BT_HallDown)},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			never: []ActionKind{A_SetMotor, A_SetDoorLamp},
+		},
+		{
+			name:      "cab requests are served",
+			state:     inMaintenance(at(0, elevator.EB_Idle, elevio.MD_Stop), -1),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: merge(request(2, elevio.BT_Cab), request(3, elevio.BT_HallDown))},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Up,
+			actions: []Action{motor(elevio.MD_Up)},
+			check: func(t *testing.T, s State) {
+				if s.Elevator.Requests[3][elevio.BT_HallDown] {
+					t.Errorf("hall request kept in maintenance")
+				}
+			},
+		},
+		{
+			name:      "the current stop is finished",
+			state:     with(at(1, elevator.EB_DoorOpen, elevio.MD_Up), request(3, elevio.BT_HallDown)),
+			event:     Event{Kind: EV_Maintenance, Maintenance: true, Floor: 0},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Up,
+			never: []ActionKind{A_SetDoorLamp, A_SetMotor, A_StartDoorTimer},
+			check: func(t *testing.T, s State) {
+				if s.HoldingDoor || hasRequests(s.Elevator) {
+					t.Errorf("stop not finished the usual way: %+v", s)
+				}
+				s, actions := Transition(s, Event{Kind: EV_DoorTimeout, Now: epoch})
+				if s.Elevator.Behaviour != elevator.EB_Moving || !s.Parking || !hasAction(actions, motor(elevio.MD_Down)) {
+					t.Errorf("did not leave for the maintenance floor after the stop: %+v %+v", s, actions)
+				}
+			},
+		},
+		{
+			name:      "idle goes to the maintenance floor",
+			state:     at(2, elevator.EB_Idle, elevio.MD_Stop),
+			event:     Event{Kind: EV_Maintenance, Maintenance: true, Floor: 0},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Down,
+			actions: []Action{motor(elevio.MD_Down)},
+		},
+		{
+			name: "arrival at the maintenance floor holds the door open",
+			state: func() State {
+				s := inMaintenance(at(1, elevator.EB_Moving, elevio.MD_Down), 0)
+				s.Parking = true
+				return s
+			}(),
+			event:     Event{Kind: EV_FloorArrival, Floor: 0},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{motor(elevio.MD_Stop), doorOpened},
+			never:   []ActionKind{A_StartDoorTimer},
+			check: func(t *testing.T, s State) {
+				if !s.HoldingDoor {
+					t.Errorf("door not held")
+				}
+			},
+		},
+		{
+			name:      "held door ignores the door timer",
+			state:     holding(0),
+			event:     Event{Kind: EV_DoorTimeout},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			never: []ActionKind{A_SetDoorLamp, A_SetMotor},
+		},
+		{
+			name:      "leaving maintenance closes the door the usual way",
+			state:     holding(0),
+			event:     Event{Kind: EV_Maintenance, Floor: 0},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{doorTimer},
+			check: func(t *testing.T, s State) {
+				if s.HoldingDoor || s.Elevator.Maintenance {
+					t.Errorf("still in maintenance: %+v", s)
+				}
+			},
+		},
+	})
+}
+
+func TestRecall(t *testing.T) {
+	inRecall := func(s State, floor int) State {
+		s.Recall = true
+		s.RecallFloor = floor
+		return s
+	}
+	// onTheWay is an elevator in recall heading down from floor to floor 0
+	onTheWay := func(floor int) State {
+		s := inRecall(at(floor, elevator.EB_Moving, elevio.MD_Down), 0)
+		s.Parking = true
+		return s
+	}
+	held := func() State {
+		s := inRecall(at(0, elevator.EB_DoorOpen, elevio.MD_Stop), 0)
+		s.HoldingDoor = true
+		return s
+	}()
+	runCoreCases(t, []coreCase{
+		{
+			name:      "idle goes to the recall floor",
+			state:     with(at(2, elevator.EB_Idle, elevio.MD_Stop), request(3, elevio.BT_Cab)),
+			event:     Event{Kind: EV_Recall, Recall: true, Floor: 0},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Down,
+			actions: []Action{motor(elevio.MD_Down), {Kind: A_SetCabLamp, Floor: 3, Value: false}},
+			check: func(t *testing.T, s State) {
+				if hasRequests(s.Elevator) || !s.Parking {
+					t.Errorf("requests kept or not heading for the recall floor: %+v", s)
+				}
+			},
+		},
+		{
+			name:      "open door closes and leaves",
+			state:     with(at(2, elevator.EB_DoorOpen, elevio.MD_Stop), request(3, elevio.BT_Cab)),
+			event:     Event{Kind: EV_Recall, Recall: true, Floor: 0},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Down,
+			actions: []Action{doorClosed, motor(elevio.MD_Down)},
+		},
+		{
+			name:      "moving away turns around",
+			state:     with(at(1, elevator.EB_Moving, elevio.MD_Up), request(3, elevio.BT_Cab)),
+			event:     Event{Kind: EV_Recall, Recall: true, Floor: 0},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Down,
+			actions: []Action{motor(elevio.MD_Down)},
+		},
+		{
+			name:      "floors on the way are passed",
+			state:     onTheWay(2),
+			event:     Event{Kind: EV_FloorArrival, Floor: 1},
+			behaviour: elevator.EB_Moving, dir: elevio.MD_Down,
+			never: []ActionKind{A_SetMotor, A_SetDoorLamp},
+		},
+		{
+			name:      "arrival at the recall floor holds the door open",
+			state:     onTheWay(1),
+			event:     Event{Kind: EV_FloorArrival, Floor: 0},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{motor(elevio.MD_Stop), doorOpened},
+			never:   []ActionKind{A_StartDoorTimer},
+			check: func(t *testing.T, s State) {
+				if !s.HoldingDoor {
+					t.Errorf("door not held")
+				}
+			},
+		},
+		{
+			name:      "held door ignores the door timer",
+			state:     held,
+			event:     Event{Kind: EV_DoorTimeout},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			never: []ActionKind{A_SetDoorLamp, A_SetMotor},
+		},
+		{
+			name:      "requests are ignored",
+			state:     held,
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(3, elevio.BT_Cab)},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			never: []ActionKind{A_StartDoorTimer, A_SetMotor},
+			check: func(t *testing.T, s State) {
+				if hasRequests(s.Elevator) || !s.HoldingDoor {
+					t.Errorf("request taken during recall: %+v", s)
+				}
+			},
+		},
+		{
+			name:      "reset closes the door the usual way",
+			state:     held,
+			event:     Event{Kind: EV_Recall, Floor: 0},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			actions: []Action{doorTimer},
+			check: func(t *testing.T, s State) {
+				if s.Recall || s.HoldingDoor {
+					t.Errorf("still in recall: %+v", s)
+				}
+			},
+		},
+	})
+}
+
+func TestOrderEvents(t *testing.T) {
+	var orders structs.LocalOrders
+	orders.Requests = request(2, elevio.BT_HallUp)
+	orders.Priorities[2][elevio.BT_HallUp] = structs.PriorityHigh
+	orders.ParkFloor = 3
+
+	s := at(0, elevator.EB_Idle, elevio.MD_Stop)
+	var actions []Action
+	for _, ev := range orderEvents(orders) {
+		var more []Action
+		s, more = Transition(s, ev)
+		actions = append(actions, more...)
+	}
+	if s.Elevator.HallPriority != orders.Priorities {
+		t.Errorf("priorities not applied: %v", s.Elevator.HallPriority)
+	}
+	if s.Elevator.Behaviour != elevator.EB_Moving || !hasAction(actions, motor(elevio.MD_Up)) {
+		t.Errorf("not on the way to the request: %+v", s.Elevator)
+	}
+	if s.Parking || s.ParkFloor != 3 {
+		t.Errorf("busy elevator parking: %+v", s)
+	}
+	if s.Recall {
+		t.Errorf("recall started without being active")
+	}
+}
+
+func TestFullCar(t *testing.T) {
+	full := func(s State) State {
+		s.Elevator.LoadKg = config.FullLoadKg
+		return s
+	}
+	// keepsHall checks that the hall call at floor is neither cleared nor dropped
+	keepsHall := func(floor int, btn elevio.ButtonType) func(t *testing.T, s State) {
+		return func(t *testing.T, s State) {
+			if s.Elevator.Cleared[floor][btn] {
+				t.Errorf("full car reported the hall call at floor %d as served", floor)
+			}
+			if !s.Elevator.Requests[floor][btn] {
+				t.Errorf("full car dropped the hall call at floor %d", floor)
+			}
+		}
+	}
+	runCoreCases(t, []coreCase{
+		{
+			name:      "last request is a hall call",
+			state:     full(with(at(1, elevator.EB_Moving, elevio.MD_Down), request(0, elevio.BT_HallUp))),
+			event:     Event{Kind: EV_FloorArrival, Floor: 0},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Down,
+			check: keepsHall(0, elevio.BT_HallUp),
+		},
+		{
+			name:      "stop for a cab call at a hall call",
+			state:     full(with(at(2, elevator.EB_Moving, elevio.MD_Down), merge(request(1, elevio.BT_Cab), request(1, elevio.BT_HallDown)))),
+			event:     Event{Kind: EV_FloorArrival, Floor: 1},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Down,
+			check: func(t *testing.T, s State) {
+				if !s.Elevator.Cleared[1][elevio.BT_Cab] {
+					t.Errorf("cab call not served")
+				}
+				keepsHall(1, elevio.BT_HallDown)(t, s)
+			},
+		},
+		{
+			name:      "hall call at the open door",
+			state:     full(at(1, elevator.EB_DoorOpen, elevio.MD_Stop)),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(1, elevio.BT_HallUp)},
+			behaviour: elevator.EB_DoorOpen, dir: elevio.MD_Stop,
+			never: []ActionKind{A_StartDoorTimer},
+			check: keepsHall(1, elevio.BT_HallUp),
+		},
+		{
+			name:      "idle car stays for a hall call",
+			state:     full(at(0, elevator.EB_Idle, elevio.MD_Stop)),
+			event:     Event{Kind: EV_RequestsUpdate, Requests: request(2, elevio.BT_HallUp)},
+			behaviour: elevator.EB_Idle, dir: elevio.MD_Stop,
+			never: []ActionKind{A_SetMotor},
+			check: keepsHall(2, elevio.BT_HallUp),
+		},
+	})
+}
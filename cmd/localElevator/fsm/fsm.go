@@ -2,22 +2,12 @@ package fsm
 
 import (
 	"Driver-go/elevio"
-	"sanntids/cmd/config"
+	"sanntids/cmd/clock"
 	"sanntids/cmd/localElevator/elevator"
-	"sanntids/cmd/localElevator/requests"
 	"sanntids/cmd/localElevator/timer"
-	"time"
+	"sanntids/cmd/structs"
 )
 
-var lastMovingFloor int = -1
-var movingStartTime time.Time
-
-func setAllCabLights(e elevator.Elevator) {
-	for floor := 0; floor < config.N_FLOORS; floor++ {
-		elevio.SetButtonLamp(elevio.ButtonType(elevio.BT_Cab), floor, e.Requests[floor][elevio.BT_Cab])
-	}
-}
-
 func moveToFirstFloor(floor <-chan int) {
 	for {
 		elevio.SetMotorDirection(elevio.MD_Down)
@@ -30,161 +20,90 @@ func moveToFirstFloor(floor <-chan int) {
 	}
 }
 
-func onRequestsUpdate(el *elevator.Elevator, newRequests [config.N_FLOORS][config.N_BUTTONS]bool) {
-	el.Requests = newRequests
-	switch el.Behaviour {
-	case elevator.EB_DoorOpen:
-		movingStartTime = time.Now()
-		var zeros [config.N_FLOORS][config.N_BUTTONS]bool
-		el.Cleared = zeros
-        for floor := 0; floor < config.N_FLOORS; floor++ {
-            for btnType := 0; btnType < config.N_BUTTONS; btnType++ {
-                if newRequests[floor][btnType] {
-                    if requests.RequestsShouldClearImmediately(*el, floor, elevio.ButtonType(btnType)) {
-                        el.Cleared[floor][btnType] = true
-						el.Requests[floor][btnType] = false
-                        timer.TimerStart(el.Config.DoorOpenDuration_s)
-                    }
-                }
-            }
-        }
-	case elevator.EB_Moving:
-		if lastMovingFloor == -1 {
-			lastMovingFloor = el.Floor
-			movingStartTime = time.Now()
-		}
-	case elevator.EB_Idle:
-		lastMovingFloor = -1
-		movingStartTime = time.Now()
-		pair := requests.RequestsChooseDirection(*el)
-		el.MotorDirection = pair.MotorDirection
-		el.Behaviour = pair.Behaviour
-		switch pair.Behaviour {
-		case elevator.EB_DoorOpen:
-			elevio.SetDoorOpenLamp(true)
-			timer.TimerStart(el.Config.DoorOpenDuration_s)
-			cleared := requests.RequestsGetClearedAtCurrentFloor(*el)
-			el.Cleared = cleared
-			*el = requests.RequestsClearAtCurrentFloor(*el)
-
-		case elevator.EB_Moving:
-			elevio.SetMotorDirection(el.MotorDirection)
-
-		case elevator.EB_Idle:
+// execute carries out the actions returned by Transition
+func execute(actions []Action, doorTimer *timer.DoorTimer) {
+	for _, action := range actions {
+		switch action.Kind {
+		case A_SetMotor:
+			elevio.SetMotorDirection(action.Motor)
+		case A_SetDoorLamp:
+			elevio.SetDoorOpenLamp(action.Value)
+		case A_SetCabLamp:
+			elevio.SetButtonLamp(elevio.BT_Cab, action.Floor, action.Value)
+		case A_SetFloorIndicator:
+			elevio.SetFloorIndicator(action.Floor)
+		case A_StartDoorTimer:
+			doorTimer.Start()
+		case A_PauseDoorTimer:
+			doorTimer.Pause()
+		case A_ResumeDoorTimer:
+			doorTimer.Resume()
 		}
 	}
+}
 
-	setAllCabLights(*el)
-	
-	if el.Behaviour == elevator.EB_Moving && 
-		lastMovingFloor == el.Floor && 
-		time.Since(movingStartTime) >4*time.Second {
-		el.Stop = true
-	} else{
-		el.Stop = false
+// orderEvents splits what the order manager sends every tick into events.
+// Priorities go first, so the FSM has them when the requests arrive.
+func orderEvents(orders structs.LocalOrders) []Event {
+	return []Event{
+		{Kind: EV_Priority, Priorities: orders.Priorities},
+		{Kind: EV_RequestsUpdate, Requests: orders.Requests},
+		{Kind: EV_ParkingUpdate, Floor: orders.ParkFloor},
+		{Kind: EV_Recall, Recall: orders.Recall.Active, Floor: orders.Recall.Floor},
 	}
 }
 
-func onFloorArrival(el *elevator.Elevator, newFloor int) {
-	// Update the last moving floor when we arrive at a new floor
-	lastMovingFloor = newFloor
-	movingStartTime = time.Now()
+func Fsm(
+	clk clock.Clock,
+	ordersChan <-chan structs.LocalOrders,
+	maintenanceChan <-chan structs.Maintenance,
+	loadChan <-chan int,
+	drvFloors chan int,
+	drvObstr chan bool,
+	drvStop chan bool,
+	elevatorCh chan<- elevator.Elevator) {
+
+	s := InitialState(elevator.ElevatorInit())
+	doorTimer := timer.NewDoorTimer(clk, s.Elevator.Config.DoorOpenDuration_s)
+	elevatorCh <- s.Elevator
+
+	execute(cabLightActions(s.Elevator), doorTimer)
+	elevio.SetFloorIndicator(0)
+	elevio.SetDoorOpenLamp(false)
+	moveToFirstFloor(drvFloors)
 
-	el.Floor = newFloor
+	for {
+		var events []Event
+		select {
+		case orders := <-ordersChan:
+			events = orderEvents(orders)
 
-	elevio.SetFloorIndicator(el.Floor)
+		case maintenance := <-maintenanceChan:
+			events = []Event{{Kind: EV_Maintenance, Maintenance: maintenance.On, Floor: maintenance.Floor}}
 
-	switch el.Behaviour {
-	case elevator.EB_Moving:
-		if requests.RequestsShouldStop(*el) {
-			elevio.SetMotorDirection(elevio.MD_Stop)
-			elevio.SetDoorOpenLamp(true)
-			cleared := requests.RequestsGetClearedAtCurrentFloor(*el)
-			el.Cleared = cleared
-			*el = requests.RequestsClearAtCurrentFloor(*el)
-			timer.TimerStart(el.Config.DoorOpenDuration_s)
-			setAllCabLights(*el)
-			el.Behaviour = elevator.EB_DoorOpen
-		}
-	default:
-	}
+		case load := <-loadChan:
+			events = []Event{{Kind: EV_Load, LoadKg: load}}
 
-}
+		case floor := <-drvFloors:
+			events = []Event{{Kind: EV_FloorArrival, Floor: floor}}
 
-func onDoorTimeout(el *elevator.Elevator) {
-
-	switch el.Behaviour {
-	case elevator.EB_DoorOpen:
-		pair := requests.RequestsChooseDirection(*el)
-		el.MotorDirection = pair.MotorDirection
-		el.Behaviour = pair.Behaviour
-
-		switch el.Behaviour {
-		case elevator.EB_DoorOpen:
-			timer.TimerStart(el.Config.DoorOpenDuration_s)
-			cleared := requests.RequestsGetClearedAtCurrentFloor(*el)
-			el.Cleared = cleared
-			*el = requests.RequestsClearAtCurrentFloor(*el)
-			setAllCabLights(*el)
-
-		case elevator.EB_Moving, elevator.EB_Idle:
-			elevio.SetDoorOpenLamp(false)
-			elevio.SetMotorDirection(el.MotorDirection)
-		}
+		case <-doorTimer.TimeoutChan():
+			events = []Event{{Kind: EV_DoorTimeout}}
 
-	default:
-	}
-}
+		case obstruction := <-drvObstr:
+			events = []Event{{Kind: EV_Obstruction, Obstruction: obstruction}}
 
-func onObstruction(el *elevator.Elevator, obstruction bool) {
-	el.Obstruction = obstruction
-	switch {
-	case obstruction:
-		timer.TimerDisable()
-	case !obstruction:
-		timer.TimerEnable()
-		if el.Behaviour == elevator.EB_DoorOpen {
-			timer.TimerStart(config.DoorOpenDuration_s)
+		case <-drvStop:
+			//Optional - if stop button causes a state change
+			continue
 		}
-	}
-}
 
-func Fsm(
-    drvButtons chan [config.N_FLOORS][config.N_BUTTONS]bool,
-    drvFloors chan int,
-    drvObstr chan bool,
-    drvStop chan bool,
-	elevatorCh chan <- elevator.Elevator) {
-
-    e := elevator.ElevatorInit()
-	elevatorCh <- e
-
-    setAllCabLights(e)
-    elevio.SetFloorIndicator(0)
-    elevio.SetDoorOpenLamp(false)
-    moveToFirstFloor(drvFloors)
-
-
-    for {
-        select {
-        case newRequests := <-drvButtons:
-			onRequestsUpdate(&e, newRequests)
-			elevatorCh <- e
-
-        case floor := <-drvFloors:
-            onFloorArrival(&e, floor)
-			elevatorCh <- e
-
-        case <-timer.TimeoutChan():
-            onDoorTimeout(&e)
-			elevatorCh <- e
-
-        case obstruction := <-drvObstr:
-            onObstruction(&e, obstruction)
-			elevatorCh <- e
-
-        case <-drvStop:
-            //Optional - if stop button causes a state change
-        }
-    }
+		for _, ev := range events {
+			ev.Now = clk.Now()
+			var actions []Action
+			s, actions = Transition(s, ev)
+			execute(actions, doorTimer)
+		}
+		elevatorCh <- s.Elevator
+	}
 }
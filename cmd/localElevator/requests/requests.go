@@ -3,6 +3,7 @@ package requests
 import (
     "sanntids/cmd/localElevator/elevator"
     "sanntids/cmd/config"
+    "sanntids/cmd/structs"
 	"Driver-go/elevio"
 )
 
@@ -42,7 +43,44 @@ func requestsCurrentFloor(e elevator.Elevator) bool {
     return false
 }
 
+// serving returns e with only the requests it should serve now. A car with
+// a priority or exclusive call passes the hall calls below that priority, but
+// still serves its cab calls so no passenger is carried past their floor.
+// A full car serves only its cab calls, as no one can get on, and leaves its
+// hall calls assigned for the master to give to another car.
+func serving(e elevator.Elevator) elevator.Elevator {
+    if elevator.IsFull(e) {
+        for f := 0; f < config.N_FLOORS; f++ {
+            e.Requests[f][elevio.BT_HallUp] = false
+            e.Requests[f][elevio.BT_HallDown] = false
+        }
+        return e
+    }
+    top := structs.PriorityNormal
+    for f := 0; f < config.N_FLOORS; f++ {
+        for btn := elevio.BT_HallUp; btn <= elevio.BT_HallDown; btn++ {
+            if e.Requests[f][btn] && e.HallPriority[f][btn] > top {
+                top = e.HallPriority[f][btn]
+            }
+        }
+    }
+    if top == structs.PriorityNormal {
+        return e
+    }
+    for f := 0; f < config.N_FLOORS; f++ {
+        for btn := elevio.BT_HallUp; btn <= elevio.BT_HallDown; btn++ {
+            if e.HallPriority[f][btn] < top {
+                e.Requests[f][btn] = false
+            }
+        }
+    }
+    return e
+}
+
+// RequestsChooseDirection picks the direction to serve the requests in,
+// heading for priority calls first.
 func RequestsChooseDirection(e elevator.Elevator) dirnBehaviourPair {
+    e = serving(e)
     switch e.MotorDirection {
     case elevio.MD_Up:
         if requestsFloorsAbove(e) {
@@ -81,7 +119,11 @@ func RequestsChooseDirection(e elevator.Elevator) dirnBehaviourPair {
     }
 }
 
+// RequestsShouldStop decides whether to stop at the current floor. A full
+// car, or one on its way to a priority call, passes the requests it is not
+// serving.
 func RequestsShouldStop(e elevator.Elevator) bool {
+    e = serving(e)
     switch e.MotorDirection {
     case elevio.MD_Down:
         return e.Requests[e.Floor][elevio.BT_HallDown] || 
@@ -100,7 +142,14 @@ func RequestsShouldStop(e elevator.Elevator) bool {
     }
 }
 
+// RequestsShouldClearImmediately decides whether a request made at the floor
+// the door is open at is served at once. A request the car passes, like a
+// normal hall call while it is on its way to a priority call, never is.
 func RequestsShouldClearImmediately(e elevator.Elevator, btnFloor int, btnType elevio.ButtonType) bool {
+    e.Requests[btnFloor][btnType] = true
+    if !serving(e).Requests[btnFloor][btnType] {
+        return false
+    }
     switch e.Config.ClearRequestVariant {
     case config.CV_All:
         return e.Floor == btnFloor
@@ -117,42 +166,24 @@ func RequestsShouldClearImmediately(e elevator.Elevator, btnFloor int, btnType e
     }
 }
 
+// RequestsClearAtCurrentFloor removes the requests served by stopping at
+// the current floor.
 func RequestsClearAtCurrentFloor(e elevator.Elevator) elevator.Elevator {
-    switch e.Config.ClearRequestVariant {
-    case config.CV_All:
-        for btn := 0; btn < int(config.N_BUTTONS); btn++ {
+    cleared := RequestsGetClearedAtCurrentFloor(e)
+    for btn := 0; btn < config.N_BUTTONS; btn++ {
+        if cleared[e.Floor][btn] {
             e.Requests[e.Floor][btn] = false
         }
-
-    case config.CV_InDirn:
-        e.Requests[e.Floor][elevio.BT_Cab] = false
-
-        switch e.MotorDirection {
-        case elevio.MD_Up:
-            e.Requests[e.Floor][elevio.BT_HallUp] = false
-
-            if !requestsFloorsAbove(e) && !e.Requests[e.Floor][elevio.BT_HallUp] {
-                e.Requests[e.Floor][elevio.BT_HallDown] = false
-            }
-
-        case elevio.MD_Down:
-            e.Requests[e.Floor][elevio.BT_HallDown] = false
-            if !requestsFloorsBelow(e) && !e.Requests[e.Floor][elevio.BT_HallDown] {
-                e.Requests[e.Floor][elevio.BT_HallUp] = false
-            }
-
-        case elevio.MD_Stop:
-            fallthrough
-        default:
-            e.Requests[e.Floor][elevio.BT_HallUp] = false
-            e.Requests[e.Floor][elevio.BT_HallDown] = false
-        }
     }
     return e
 }
 
+// RequestsGetClearedAtCurrentFloor returns the requests served by stopping at
+// the current floor. Only the requests the car is serving are cleared, so a
+// stop made for a priority call leaves the normal hall calls there waiting.
 func RequestsGetClearedAtCurrentFloor(e elevator.Elevator) [config.N_FLOORS][config.N_BUTTONS]bool {
 	var cleared [config.N_FLOORS][config.N_BUTTONS]bool
+	e = serving(e)
 	floor := e.Floor
 	switch e.Config.ClearRequestVariant {
 	case config.CV_All:
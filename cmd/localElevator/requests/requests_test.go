@@ -0,0 +1,387 @@
+package requests
+
+import (
+	"Driver-go/elevio"
+	"fmt"
+	"sanntids/cmd/config"
+	"sanntids/cmd/localElevator/elevator"
+	"sanntids/cmd/structs"
+	"testing"
+)
+
+type requestMatrix = [config.N_FLOORS][config.N_BUTTONS]bool
+
+var directions = []elevio.MotorDirection{elevio.MD_Up, elevio.MD_Down, elevio.MD_Stop}
+var variants = []config.ClearRequestVariant{config.CV_All, config.CV_InDirn}
+
+// buttonExists is false for the hall buttons that are not mounted:
+// no up button at the top floor and no down button at the bottom floor.
+func buttonExists(floor int, btn int) bool {
+	switch elevio.ButtonType(btn) {
+	case elevio.BT_HallUp:
+		return floor < config.N_FLOORS-1
+	case elevio.BT_HallDown:
+		return floor > 0
+	default:
+		return true
+	}
+}
+
+// allRequestMatrices enumerates every combination of the buttons that exist.
+func allRequestMatrices() []requestMatrix {
+	type button struct{ floor, btn int }
+	var buttons []button
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		for btn := 0; btn < config.N_BUTTONS; btn++ {
+			if buttonExists(floor, btn) {
+				buttons = append(buttons, button{floor, btn})
+			}
+		}
+	}
+
+	matrices := make([]requestMatrix, 0, 1<<len(buttons))
+	for mask := 0; mask < 1<<len(buttons); mask++ {
+		var m requestMatrix
+		for i, b := range buttons {
+			m[b.floor][b.btn] = mask&(1<<i) != 0
+		}
+		matrices = append(matrices, m)
+	}
+	return matrices
+}
+
+// forAllElevators calls f for every request matrix, floor, motor direction and clear variant.
+func forAllElevators(t *testing.T, f func(t *testing.T, e elevator.Elevator)) {
+	for _, m := range allRequestMatrices() {
+		for floor := 0; floor < config.N_FLOORS; floor++ {
+			for _, dirn := range directions {
+				for _, variant := range variants {
+					e := elevator.Elevator{
+						Floor:          floor,
+						MotorDirection: dirn,
+						Requests:       m,
+						Behaviour:      elevator.EB_Moving,
+					}
+					e.Config.ClearRequestVariant = variant
+					e.Config.DoorOpenDuration_s = config.DoorOpenDuration_s
+					f(t, e)
+					if t.Failed() {
+						t.FailNow()
+					}
+				}
+			}
+		}
+	}
+}
+
+func describe(e elevator.Elevator) string {
+	return fmt.Sprintf("floor=%d dirn=%d variant=%d requests=%v", e.Floor, e.MotorDirection, e.Config.ClearRequestVariant, e.Requests)
+}
+
+func anyRequests(m requestMatrix) bool {
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		for btn := 0; btn < config.N_BUTTONS; btn++ {
+			if m[floor][btn] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestAllRequestMatricesCount(t *testing.T) {
+	buttons := config.N_FLOORS*config.N_BUTTONS - 2
+	if got := len(allRequestMatrices()); got != 1<<buttons {
+		t.Fatalf("expected %d request matrices, got %d", 1<<buttons, got)
+	}
+}
+
+func TestRequestsChooseDirection(t *testing.T) {
+	forAllElevators(t, func(t *testing.T, e elevator.Elevator) {
+		pair := RequestsChooseDirection(e)
+
+		if !anyRequests(e.Requests) {
+			if pair.Behaviour != elevator.EB_Idle || pair.MotorDirection != elevio.MD_Stop {
+				t.Errorf("no requests but got %+v: %s", pair, describe(e))
+			}
+			return
+		}
+
+		switch pair.Behaviour {
+		case elevator.EB_Idle:
+			t.Errorf("idle with pending requests: %s", describe(e))
+		case elevator.EB_DoorOpen:
+			if !requestsCurrentFloor(e) {
+				t.Errorf("opens door without request at current floor: %s", describe(e))
+			}
+		case elevator.EB_Moving:
+			switch pair.MotorDirection {
+			case elevio.MD_Up:
+				if !requestsFloorsAbove(e) {
+					t.Errorf("moves up without requests above: %s", describe(e))
+				}
+			case elevio.MD_Down:
+				if !requestsFloorsBelow(e) {
+					t.Errorf("moves down without requests below: %s", describe(e))
+				}
+			default:
+				t.Errorf("moving with stopped motor: %s", describe(e))
+			}
+		}
+
+		// Keep going in the current direction as long as there is something to serve there
+		if e.MotorDirection == elevio.MD_Up && requestsFloorsAbove(e) &&
+			(pair.Behaviour != elevator.EB_Moving || pair.MotorDirection != elevio.MD_Up) {
+			t.Errorf("reversed with requests above: %+v %s", pair, describe(e))
+		}
+		if e.MotorDirection == elevio.MD_Down && requestsFloorsBelow(e) &&
+			(pair.Behaviour != elevator.EB_Moving || pair.MotorDirection != elevio.MD_Down) {
+			t.Errorf("reversed with requests below: %+v %s", pair, describe(e))
+		}
+	})
+}
+
+func TestRequestsShouldStop(t *testing.T) {
+	forAllElevators(t, func(t *testing.T, e elevator.Elevator) {
+		stop := RequestsShouldStop(e)
+		floor := e.Floor
+
+		var hallInDirn bool
+		var nothingAhead bool
+		switch e.MotorDirection {
+		case elevio.MD_Up:
+			hallInDirn = e.Requests[floor][elevio.BT_HallUp]
+			nothingAhead = !requestsFloorsAbove(e)
+		case elevio.MD_Down:
+			hallInDirn = e.Requests[floor][elevio.BT_HallDown]
+			nothingAhead = !requestsFloorsBelow(e)
+		default:
+			if !stop {
+				t.Errorf("stopped elevator should always stop: %s", describe(e))
+			}
+			return
+		}
+
+		reason := e.Requests[floor][elevio.BT_Cab] || hallInDirn || nothingAhead
+		if stop && !reason {
+			t.Errorf("stops at a floor with no reason: %s", describe(e))
+		}
+		if !stop && reason {
+			t.Errorf("passes a floor it should stop at: %s", describe(e))
+		}
+		atEnd := (e.MotorDirection == elevio.MD_Up && floor == config.N_FLOORS-1) ||
+			(e.MotorDirection == elevio.MD_Down && floor == 0)
+		if atEnd && !stop {
+			t.Errorf("passes the end of the shaft: %s", describe(e))
+		}
+	})
+}
+
+func TestRequestsClearAtCurrentFloor(t *testing.T) {
+	forAllElevators(t, func(t *testing.T, e elevator.Elevator) {
+		cleared := RequestsGetClearedAtCurrentFloor(e)
+		after := RequestsClearAtCurrentFloor(e)
+
+		for floor := 0; floor < config.N_FLOORS; floor++ {
+			for btn := 0; btn < config.N_BUTTONS; btn++ {
+				removed := e.Requests[floor][btn] && !after.Requests[floor][btn]
+				if cleared[floor][btn] != removed {
+					t.Errorf("cleared set differs from removed requests at floor %d button %d: %s", floor, btn, describe(e))
+				}
+				if !e.Requests[floor][btn] && after.Requests[floor][btn] {
+					t.Errorf("clearing added a request at floor %d button %d: %s", floor, btn, describe(e))
+				}
+				if floor != e.Floor && cleared[floor][btn] {
+					t.Errorf("cleared request at other floor %d: %s", floor, describe(e))
+				}
+			}
+		}
+
+		if after.Requests[e.Floor][elevio.BT_Cab] {
+			t.Errorf("cab request at current floor not cleared: %s", describe(e))
+		}
+
+		switch e.Config.ClearRequestVariant {
+		case config.CV_All:
+			for btn := 0; btn < config.N_BUTTONS; btn++ {
+				if after.Requests[e.Floor][btn] {
+					t.Errorf("CV_All left button %d at current floor: %s", btn, describe(e))
+				}
+			}
+		case config.CV_InDirn:
+			up := after.Requests[e.Floor][elevio.BT_HallUp]
+			down := after.Requests[e.Floor][elevio.BT_HallDown]
+			switch e.MotorDirection {
+			case elevio.MD_Up:
+				if up {
+					t.Errorf("CV_InDirn moving up left hall up: %s", describe(e))
+				}
+				if down != (e.Requests[e.Floor][elevio.BT_HallDown] && requestsFloorsAbove(e)) {
+					t.Errorf("CV_InDirn moving up handled hall down wrongly: %s", describe(e))
+				}
+			case elevio.MD_Down:
+				if down {
+					t.Errorf("CV_InDirn moving down left hall down: %s", describe(e))
+				}
+				if up != (e.Requests[e.Floor][elevio.BT_HallUp] && requestsFloorsBelow(e)) {
+					t.Errorf("CV_InDirn moving down handled hall up wrongly: %s", describe(e))
+				}
+			default:
+				if up || down {
+					t.Errorf("CV_InDirn stopped left hall requests: %s", describe(e))
+				}
+			}
+		}
+	})
+}
+
+func TestRequestsShouldClearImmediately(t *testing.T) {
+	forAllElevators(t, func(t *testing.T, e elevator.Elevator) {
+		for floor := 0; floor < config.N_FLOORS; floor++ {
+			for btn := 0; btn < config.N_BUTTONS; btn++ {
+				if !buttonExists(floor, btn) {
+					continue
+				}
+				immediate := RequestsShouldClearImmediately(e, floor, elevio.ButtonType(btn))
+				if immediate && floor != e.Floor {
+					t.Errorf("clears request at other floor %d immediately: %s", floor, describe(e))
+				}
+				if e.Config.ClearRequestVariant == config.CV_All && immediate != (floor == e.Floor) {
+					t.Errorf("CV_All should clear everything at current floor: %s", describe(e))
+				}
+				if !immediate {
+					continue
+				}
+
+				// A request that is cleared immediately must also be one that clearing at the floor removes
+				single := e
+				single.Requests = requestMatrix{}
+				single.Requests[floor][btn] = true
+				if RequestsClearAtCurrentFloor(single).Requests[floor][btn] {
+					t.Errorf("button %d cleared immediately but not by clearing the floor: %s", btn, describe(e))
+				}
+			}
+		}
+	})
+}
+
+func TestFullCarPassesHallCalls(t *testing.T) {
+	forAllElevators(t, func(t *testing.T, e elevator.Elevator) {
+		e.LoadKg = config.FullLoadKg
+		cabs := e
+		for floor := 0; floor < config.N_FLOORS; floor++ {
+			cabs.Requests[floor][elevio.BT_HallUp] = false
+			cabs.Requests[floor][elevio.BT_HallDown] = false
+		}
+
+		// A full car goes where its passengers are going and nowhere else
+		if got, want := RequestsChooseDirection(e), RequestsChooseDirection(cabs); got != want {
+			t.Errorf("full car chose %+v, want %+v: %s", got, want, describe(e))
+		}
+		if e.MotorDirection != elevio.MD_Stop && RequestsShouldStop(e) != RequestsShouldStop(cabs) {
+			t.Errorf("full car stop=%v: %s", RequestsShouldStop(e), describe(e))
+		}
+		cleared := RequestsGetClearedAtCurrentFloor(e)
+		after := RequestsClearAtCurrentFloor(e)
+		for btn := elevio.BT_HallUp; btn <= elevio.BT_HallDown; btn++ {
+			if cleared[e.Floor][btn] || after.Requests[e.Floor][btn] != e.Requests[e.Floor][btn] {
+				t.Errorf("full car cleared hall button %d: %s", btn, describe(e))
+			}
+			if RequestsShouldClearImmediately(e, e.Floor, btn) {
+				t.Errorf("full car cleared hall button %d at once: %s", btn, describe(e))
+			}
+		}
+	})
+}
+
+func TestPriorityCallsPreemptStops(t *testing.T) {
+	tests := []struct {
+		name     string
+		at       elevio.ButtonType
+		priority structs.Priority
+		want     bool
+	}{
+		{"normal hall call passed for priority call", elevio.BT_HallUp, structs.PriorityHigh, false},
+		{"cab call kept for priority call", elevio.BT_Cab, structs.PriorityHigh, true},
+		{"cab call kept for exclusive call", elevio.BT_Cab, structs.PriorityExclusive, true},
+		{"normal hall call passed for exclusive call", elevio.BT_HallUp, structs.PriorityExclusive, false},
+		{"normal calls only", elevio.BT_HallUp, structs.PriorityNormal, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := elevator.Elevator{Floor: 1, MotorDirection: elevio.MD_Up, Behaviour: elevator.EB_Moving}
+			e.Requests[1][tt.at] = true
+			e.Requests[3][elevio.BT_HallDown] = true
+			e.HallPriority[3][elevio.BT_HallDown] = tt.priority
+			if got := RequestsShouldStop(e); got != tt.want {
+				t.Errorf("stop=%v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// An idle car heads for the priority call first
+	e := elevator.Elevator{Floor: 1, MotorDirection: elevio.MD_Stop, Behaviour: elevator.EB_Idle}
+	e.Requests[0][elevio.BT_HallUp] = true
+	e.Requests[3][elevio.BT_HallDown] = true
+	e.HallPriority[3][elevio.BT_HallDown] = structs.PriorityHigh
+	if pair := RequestsChooseDirection(e); pair.MotorDirection != elevio.MD_Up {
+		t.Errorf("went %d instead of up to the priority call", pair.MotorDirection)
+	}
+}
+
+func TestPriorityStopLeavesNormalCalls(t *testing.T) {
+	for _, variant := range variants {
+		e := elevator.Elevator{Floor: 2, MotorDirection: elevio.MD_Down, Behaviour: elevator.EB_Moving}
+		e.Config.ClearRequestVariant = variant
+		e.Requests[2][elevio.BT_HallDown] = true
+		e.Requests[2][elevio.BT_HallUp] = true
+		e.Requests[0][elevio.BT_HallUp] = true
+		e.HallPriority[2][elevio.BT_HallDown] = structs.PriorityHigh
+
+		cleared := RequestsGetClearedAtCurrentFloor(e)
+		after := RequestsClearAtCurrentFloor(e)
+		if !cleared[2][elevio.BT_HallDown] || after.Requests[2][elevio.BT_HallDown] {
+			t.Errorf("variant %d: priority call not cleared", variant)
+		}
+		if cleared[2][elevio.BT_HallUp] || !after.Requests[2][elevio.BT_HallUp] {
+			t.Errorf("variant %d: normal call cleared by the priority stop", variant)
+		}
+		if RequestsShouldClearImmediately(e, 2, elevio.BT_HallUp) {
+			t.Errorf("variant %d: normal call cleared at once during priority service", variant)
+		}
+	}
+}
+
+func TestExclusiveCallKeepsCabCalls(t *testing.T) {
+	e := elevator.Elevator{Floor: 0, MotorDirection: elevio.MD_Stop, Behaviour: elevator.EB_Idle}
+	e.Config.ClearRequestVariant = config.CV_All
+	e.Requests[1][elevio.BT_Cab] = true
+	e.Requests[2][elevio.BT_HallUp] = true
+	e.Requests[3][elevio.BT_HallDown] = true
+	e.HallPriority[3][elevio.BT_HallDown] = structs.PriorityExclusive
+
+	if pair := RequestsChooseDirection(e); pair.MotorDirection != elevio.MD_Up {
+		t.Fatalf("went %d instead of up", pair.MotorDirection)
+	}
+	e.MotorDirection = elevio.MD_Up
+	e.Behaviour = elevator.EB_Moving
+
+	// The passenger gets off on the way
+	e.Floor = 1
+	if !RequestsShouldStop(e) {
+		t.Fatalf("passed the cab call")
+	}
+	e = RequestsClearAtCurrentFloor(e)
+	if e.Requests[1][elevio.BT_Cab] {
+		t.Errorf("cab call not cleared at its floor")
+	}
+	if pair := RequestsChooseDirection(e); pair.MotorDirection != elevio.MD_Up {
+		t.Errorf("went %d instead of on to the exclusive call", pair.MotorDirection)
+	}
+
+	// but no one else gets on
+	e.Floor = 2
+	if RequestsShouldStop(e) {
+		t.Errorf("stopped for a normal hall call")
+	}
+}
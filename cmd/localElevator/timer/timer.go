@@ -1,49 +1,127 @@
 package timer
 
 import (
+	"sanntids/cmd/clock"
+	"sync"
 	"time"
 )
 
-var timeoutChan = make(chan bool)
-var doorTimer *time.Timer
-var disabled bool
+// DoorTimer signals on TimeoutChan when the door has been open for the
+// configured duration. Every Start invalidates earlier countdowns, so a
+// stale expiry can never be delivered after Stop or a restart.
+type DoorTimer struct {
+	mu        sync.Mutex
+	clk       clock.Clock
+	duration  time.Duration
+	remaining time.Duration
+	deadline  time.Time
+	timer     clock.Timer
+	running   bool
+	paused    bool
+	gen       uint64
+	timeoutCh chan bool
+}
 
-// TimerStart starts a timer that will send a timeout event after the given duration,
-// but if the timer is disabled, it simply stops any running timer and does nothing.
-func TimerStart(duration float64) {
-	if disabled {
-		if doorTimer != nil {
-			doorTimer.Stop()
-		}
-		return
+func NewDoorTimer(clk clock.Clock, duration_s float64) *DoorTimer {
+	return &DoorTimer{
+		clk:       clk,
+		duration:  secondsToDuration(duration_s),
+		timeoutCh: make(chan bool, 1),
 	}
-	if doorTimer != nil {
-		doorTimer.Stop()
+}
+
+func secondsToDuration(duration_s float64) time.Duration {
+	return time.Duration(duration_s * float64(time.Second))
+}
+
+// Start (re)starts the countdown with the full duration. While paused the
+// countdown is only armed and begins when Resume is called.
+func (t *DoorTimer) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopLocked()
+	t.remaining = t.duration
+	t.running = true
+	if !t.paused {
+		t.armLocked()
 	}
-	doorTimer = time.AfterFunc(time.Duration(duration)*time.Second, func() {
-		if !disabled {
-			timeoutChan <- true
-		}
-	})
 }
 
-func TimerStop() {
-	if doorTimer != nil {
-		doorTimer.Stop()
+// Stop cancels the countdown and discards any timeout not yet received.
+func (t *DoorTimer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopLocked()
+	t.running = false
+}
+
+// Pause freezes the countdown, keeping the time that is left.
+func (t *DoorTimer) Pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused {
+		return
+	}
+	t.paused = true
+	if t.running && t.timer != nil {
+		t.remaining = t.deadline.Sub(t.clk.Now())
+		if t.remaining < 0 {
+			t.remaining = 0
+		}
+		t.timer.Stop()
+		t.timer = nil
+		t.gen++
 	}
 }
 
-func TimerDisable() {
-	disabled = true
-	if doorTimer != nil {
-		doorTimer.Stop()
+// Resume continues a paused countdown with the time that was left.
+func (t *DoorTimer) Resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.paused {
+		return
+	}
+	t.paused = false
+	if t.running {
+		t.armLocked()
 	}
 }
 
-func TimerEnable() {
-	disabled = false
+func (t *DoorTimer) TimeoutChan() <-chan bool {
+	return t.timeoutCh
 }
 
-func TimeoutChan() <-chan bool {
-	return timeoutChan
+func (t *DoorTimer) armLocked() {
+	t.gen++
+	gen := t.gen
+	t.deadline = t.clk.Now().Add(t.remaining)
+	t.timer = t.clk.AfterFunc(t.remaining, func() {
+		t.expire(gen)
+	})
+}
+
+func (t *DoorTimer) expire(gen uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if gen != t.gen || !t.running || t.paused {
+		return
+	}
+	t.running = false
+	t.timer = nil
+	select {
+	case t.timeoutCh <- true:
+	default:
+	}
+}
+
+func (t *DoorTimer) stopLocked() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.gen++
+	select {
+	case <-t.timeoutCh:
+	default:
+	}
 }
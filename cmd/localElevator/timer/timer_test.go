@@ -0,0 +1,169 @@
+package timer
+
+import (
+	"sanntids/cmd/clock"
+	"sync"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestTimer() (*DoorTimer, *clock.Fake) {
+	clk := clock.NewFake(epoch)
+	return NewDoorTimer(clk, 3), clk
+}
+
+func timedOut(t *DoorTimer) bool {
+	select {
+	case <-t.TimeoutChan():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDoorTimerTimesOut(t *testing.T) {
+	timer, clk := newTestTimer()
+	timer.Start()
+	clk.Advance(3*time.Second - time.Millisecond)
+	if timedOut(timer) {
+		t.Fatalf("timed out early")
+	}
+	clk.Advance(time.Millisecond)
+	if !timedOut(timer) {
+		t.Fatalf("did not time out")
+	}
+	clk.Advance(time.Minute)
+	if timedOut(timer) {
+		t.Errorf("timed out twice")
+	}
+}
+
+func TestDoorTimerRestartStartsOver(t *testing.T) {
+	timer, clk := newTestTimer()
+	timer.Start()
+	clk.Advance(2 * time.Second)
+	timer.Start()
+	clk.Advance(2 * time.Second)
+	if timedOut(timer) {
+		t.Fatalf("first countdown delivered after the restart")
+	}
+	clk.Advance(time.Second)
+	if !timedOut(timer) {
+		t.Errorf("restarted countdown did not time out")
+	}
+}
+
+func TestDoorTimerPauseKeepsRemainingTime(t *testing.T) {
+	timer, clk := newTestTimer()
+	timer.Start()
+	clk.Advance(time.Second)
+	timer.Pause()
+	clk.Advance(time.Minute)
+	if timedOut(timer) {
+		t.Fatalf("timed out while paused")
+	}
+
+	timer.Resume()
+	clk.Advance(2*time.Second - time.Millisecond)
+	if timedOut(timer) {
+		t.Fatalf("resumed with more than the remaining time")
+	}
+	clk.Advance(time.Millisecond)
+	if !timedOut(timer) {
+		t.Errorf("resumed countdown did not time out after the remaining 2 s")
+	}
+}
+
+func TestDoorTimerStartWhilePausedWaitsForResume(t *testing.T) {
+	timer, clk := newTestTimer()
+	timer.Pause()
+	timer.Start()
+	clk.Advance(time.Minute)
+	if timedOut(timer) {
+		t.Fatalf("timed out while paused")
+	}
+	timer.Resume()
+	clk.Advance(3 * time.Second)
+	if !timedOut(timer) {
+		t.Errorf("did not time out after resuming")
+	}
+}
+
+func TestDoorTimerStop(t *testing.T) {
+	timer, clk := newTestTimer()
+	timer.Start()
+	clk.Advance(time.Second)
+	timer.Stop()
+	clk.Advance(time.Minute)
+	if timedOut(timer) {
+		t.Errorf("stopped countdown timed out")
+	}
+
+	// A timeout that has not been received yet is discarded
+	timer.Start()
+	clk.Advance(3 * time.Second)
+	timer.Stop()
+	if timedOut(timer) {
+		t.Errorf("timeout delivered after Stop")
+	}
+	timer.Resume()
+	clk.Advance(time.Minute)
+	if timedOut(timer) || clk.Pending() != 0 {
+		t.Errorf("stopped timer came back")
+	}
+}
+
+// Run with -race: the countdown expires on the goroutine advancing the
+// clock while the FSM starts, stops, pauses and resumes it.
+func TestDoorTimerConcurrentUse(t *testing.T) {
+	timer, clk := newTestTimer()
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				clk.Advance(100 * time.Millisecond)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.TimeoutChan():
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		switch i % 4 {
+		case 0:
+			timer.Start()
+		case 1:
+			timer.Pause()
+		case 2:
+			timer.Resume()
+		case 3:
+			if i%8 == 3 {
+				timer.Stop()
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	timer.Resume()
+	timer.Start()
+	clk.Advance(3 * time.Second)
+	if !timedOut(timer) {
+		t.Errorf("did not time out after concurrent use")
+	}
+}
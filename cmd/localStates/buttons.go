@@ -0,0 +1,38 @@
+package localStates
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"time"
+)
+
+// hallButtons turns presses of the hall buttons on this elevator's panel
+// into orders.
+type hallButtons struct {
+	lastPress [config.N_FLOORS][config.N_BUTTONS]time.Time
+}
+
+// press returns the order to send for a press of a hall button, if any.
+// A second press within config.CancelDoublePressMs cancels the call and a
+// third calls the elevator again. A button this elevator is already serving
+// is lit and on its way, so pressing it does nothing, not even twice.
+func (b *hallButtons) press(floor int, button elevio.ButtonType, serving bool, now time.Time) (structs.HallOrder, bool) {
+	order := structs.HallOrder{
+		Status:      structs.New,
+		DelegatedID: "undelegated",
+		Floor:       floor,
+		Dir:         button,
+	}
+	if serving {
+		b.lastPress[floor][button] = time.Time{}
+		return order, false
+	}
+	if now.Sub(b.lastPress[floor][button]) < config.CancelDoublePressMs*time.Millisecond {
+		b.lastPress[floor][button] = time.Time{}
+		order.Status = structs.Cancelled
+		return order, true
+	}
+	b.lastPress[floor][button] = now
+	return order, true
+}
@@ -0,0 +1,52 @@
+package localStates
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestHallButtonPress(t *testing.T) {
+	window := config.CancelDoublePressMs * time.Millisecond
+	type press struct {
+		after   time.Duration
+		serving bool
+		want    structs.OrderStatus // Unknown for no order
+	}
+	tests := []struct {
+		name    string
+		presses []press
+	}{
+		{"single press calls", []press{{0, false, structs.New}}},
+		{"double press cancels", []press{{0, false, structs.New}, {window / 2, false, structs.Cancelled}}},
+		{"third press calls again", []press{{0, false, structs.New}, {window / 2, false, structs.Cancelled}, {window / 2, false, structs.New}}},
+		{"slow presses both call", []press{{0, false, structs.New}, {window, false, structs.New}}},
+		{"served call ignores a press", []press{{0, true, structs.Unknown}}},
+		{"served call ignores a double press", []press{{0, true, structs.Unknown}, {window / 2, true, structs.Unknown}}},
+		{"press after serving is a single press", []press{{0, true, structs.Unknown}, {window / 2, false, structs.New}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buttons hallButtons
+			now := epoch
+			for i, p := range tt.presses {
+				now = now.Add(p.after)
+				order, ok := buttons.press(2, elevio.BT_HallDown, p.serving, now)
+				got := structs.Unknown
+				if ok {
+					got = order.Status
+					if order.Floor != 2 || order.Dir != elevio.BT_HallDown {
+						t.Errorf("press %d gave an order for floor %d dir %d", i, order.Floor, order.Dir)
+					}
+				}
+				if got != p.want {
+					t.Errorf("press %d gave %v, want %v", i, got, p.want)
+				}
+			}
+		})
+	}
+}
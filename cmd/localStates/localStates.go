@@ -2,12 +2,18 @@ package localStates
 
 import (
 	"Driver-go/elevio"
+	"sanntids/cmd/clock"
 	"sanntids/cmd/config"
 	"sanntids/cmd/localElevator/elevator"
 	"sanntids/cmd/structs"
 )
 
+// LocalStateManager turns button presses into cab requests and hall orders,
+// and passes the state of the local elevator on. A hall button pressed twice
+// within config.CancelDoublePressMs cancels the call, unless this elevator
+// is serving it.
 func LocalStateManager(
+	clk clock.Clock,
 	localRequest <-chan elevio.ButtonEvent,
 	elevatorCh <-chan elevator.Elevator,
 	outgoingOrdersChan chan<- structs.HallOrder,
@@ -27,6 +33,7 @@ func LocalStateManager(
 	}
 
 	e := elevator.ElevatorInit()
+	var buttons hallButtons
 
 	for {
 		select {
@@ -37,14 +44,11 @@ func LocalStateManager(
 					outgoingElevStateChan <- currentState
 				}
 
-			} else if !e.Requests[request.Floor][request.Button] {
-				newOrder := structs.HallOrder{
-					Status:      structs.New,
-					DelegatedID: "undelegated",
-					Floor:       request.Floor,
-					Dir:         request.Button,
+			} else {
+				serving := e.Requests[request.Floor][request.Button]
+				if order, ok := buttons.press(request.Floor, request.Button, serving, clk.Now()); ok {
+					outgoingOrdersChan <- order
 				}
-				outgoingOrdersChan <- newOrder
 			}
 
 		case e = <-elevatorCh:
@@ -53,6 +57,8 @@ func LocalStateManager(
 			currentState.Direction = motorDirectionToString(e.MotorDirection)
 			currentState.Obstruction = e.Obstruction
 			currentState.Stop = e.Stop
+			currentState.Maintenance = e.Maintenance
+			currentState.LoadKg = e.LoadKg
 			currentState.CabRequests = elevator.GetCabRequests(e.Requests)
 			completedRequests := getClearedHallRequests(e.Cleared)
 			if len(completedRequests) > 0 {
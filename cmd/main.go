@@ -3,8 +3,11 @@ package main
 import (
 	"Driver-go/elevio"
 	"Network-go/network/localip"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"sanntids/cmd/clock"
 	"sanntids/cmd/config"
 	"sanntids/cmd/localElevator/elevator"
 	"sanntids/cmd/localElevator/fsm"
@@ -12,6 +15,10 @@ import (
 	"sanntids/cmd/localStates"
 	"sanntids/cmd/broadcastState"
 	"sanntids/cmd/networkOrders"
+	"sanntids/cmd/statusAPI"
+	"strings"
+	"sync"
+	"time"
 )
 
 func main() {
@@ -19,8 +26,70 @@ func main() {
 	port := flag.String("port", "15657", "Port number for elevator")
 	elevatorID := flag.String("id", "", "Elevator ID (defaults to local IP if not specified)")
 	broadcastPortFlag := flag.Int("broadcast", 30003, "Port for broadcasting state")
+	transportMode := flag.String("transport", string(broadcastState.Broadcast), "How to reach the other elevators: broadcast, multicast or unicast")
+	mcastGroup := flag.String("mcast-group", config.DefaultMulticastGroup, "Multicast group to use with -transport=multicast")
+	mcastTTL := flag.Int("mcast-ttl", config.DefaultMulticastTTL, "Number of router hops multicast packets may take")
+	mcastIface := flag.String("mcast-iface", "", "Network interface for multicast (chosen by the system if empty)")
+	peers := flag.String("peers", "", "Comma separated host:port of the other elevators for -transport=unicast")
+	keyFile := flag.String("keyfile", "", "File with the pre-shared cluster key used to sign broadcasts")
+	encKeyFile := flag.String("enckey", "", "File with the cluster key used to encrypt broadcasts")
+	prevEncKeyFile := flag.String("enckey-prev", "", "File with a previous encryption key that is still accepted")
+	clusterID := flag.String("cluster", config.DefaultClusterID, "Cluster ID, only elevators with the same ID work together")
+	httpAddr := flag.String("http", "", "Address to serve the status API on, e.g. localhost:8080 (off if empty)")
+	parking := flag.String("parking", config.DefaultParkingStrategy, "Where idle elevators wait: none, lobby, spread or schedule")
+	traffic := flag.String("traffic", config.DefaultTrafficSource, "How the master picks the traffic mode: calls, schedule or off")
+	maintenance := flag.Bool("maintenance", false, "Start out of service: finish cab calls and take no hall calls")
+	maintenanceFloor := flag.Int("maintenance-floor", -1, "Floor to wait at with the door open in maintenance (-1 to stay where it is)")
+	recallKey := flag.Bool("recall-key", false, "Use the stop button as the fire service recall switch (reset through the status API)")
+	listClusters := flag.Bool("list-clusters", false, "List the clusters broadcasting on the port and exit")
 	flag.Parse()
 
+	clk := clock.Real()
+
+	transport := broadcastState.Transport{
+		Mode:      broadcastState.TransportMode(*transportMode),
+		Port:      *broadcastPortFlag,
+		Group:     *mcastGroup,
+		TTL:       *mcastTTL,
+		Interface: *mcastIface,
+	}
+	if *peers != "" {
+		transport.Peers = strings.Split(*peers, ",")
+	}
+	if err := transport.Validate(); err != nil {
+		fmt.Println("Error in transport settings:", err)
+		os.Exit(1)
+	}
+
+	parkingStrategy, err := networkOrders.ParseParkingStrategy(*parking)
+	if err != nil {
+		fmt.Println("Error in parking settings:", err)
+		os.Exit(1)
+	}
+
+	trafficSource, err := networkOrders.ParseTrafficSource(*traffic)
+	if err != nil {
+		fmt.Println("Error in traffic settings:", err)
+		os.Exit(1)
+	}
+
+	if *maintenanceFloor < -1 || *maintenanceFloor >= config.N_FLOORS {
+		fmt.Println("Error in maintenance settings: no floor", *maintenanceFloor)
+		os.Exit(1)
+	}
+
+	if *listClusters {
+		clusters, err := broadcastState.ScanClusters(clk, transport, 3*time.Second)
+		if err != nil {
+			fmt.Println("Error listening for clusters:", err)
+			os.Exit(1)
+		}
+		for _, cluster := range clusters {
+			fmt.Printf("%s: %v\n", cluster.ID, cluster.Senders)
+		}
+		return
+	}
+
 	numFloors := config.N_FLOORS
 	elevPort := fmt.Sprintf("localhost:%s", *port)
 
@@ -28,7 +97,16 @@ func main() {
 	if *elevatorID == "" {
 		*elevatorID, _ = localip.LocalIP()
 	}
-	fmt.Printf("Local elevator ID: %s, Network port: %d\n", *elevatorID, *broadcastPortFlag)
+	fmt.Printf("Local elevator ID: %s, Network port: %d (%s), Cluster: %s\n", *elevatorID, *broadcastPortFlag, transport.Mode, *clusterID)
+
+	security, err := loadSecurity(*keyFile, *encKeyFile, *prevEncKeyFile)
+	if err != nil {
+		fmt.Println("Error loading cluster keys:", err)
+		os.Exit(1)
+	}
+	if security.AuthKey == nil {
+		fmt.Println("No cluster key given, broadcasts are not authenticated")
+	}
 
 	// Initialize the elevator driver
 	elevio.Init(elevPort, numFloors)
@@ -38,6 +116,7 @@ func main() {
 	drvFloors := make(chan int)
 	drvObstr := make(chan bool)
 	drvStop := make(chan bool)
+	recallChan := make(chan bool)
 
 	// Start polling inputs concurrently
 	go elevio.PollButtons(drvButtons)
@@ -45,9 +124,30 @@ func main() {
 	go elevio.PollObstructionSwitch(drvObstr)
 	go elevio.PollStopButton(drvStop)
 
+	// With the recall key the stop button starts fire service recall instead of reaching the FSM
+	fsmStop := drvStop
+	if *recallKey {
+		fsmStop = make(chan bool)
+		go func() {
+			for pressed := range drvStop {
+				if pressed {
+					recallChan <- true
+				}
+			}
+		}()
+	}
+
 	// FSM and state channels
 	elevatorCh := make(chan elevator.Elevator)
-	requestsToLocalChan := make(chan [config.N_FLOORS][config.N_BUTTONS]bool)
+	ordersToLocalChan := make(chan structs.LocalOrders)
+	maintenanceChan := make(chan structs.Maintenance, 1)
+	loadChan := make(chan int, 1)
+	destinationChan := make(chan networkOrders.DestinationRequest)
+	load := &loadSensor{ch: loadChan}
+	maintenanceCtl := &maintenanceControl{ch: maintenanceChan}
+	if *maintenance {
+		maintenanceCtl.set(structs.Maintenance{On: true, Floor: *maintenanceFloor})
+	}
 
 	// Local channels
 	outgoingLocalOrdersChan := make(chan structs.HallOrder)
@@ -58,9 +158,10 @@ func main() {
 	incomingNetworkData := make(chan structs.ElevatorDataWithID)
 	outgoingNetworkData := make(chan structs.ElevatorDataWithID)
 
-	go fsm.Fsm(requestsToLocalChan, drvFloors, drvObstr, drvStop, elevatorCh)
+	go fsm.Fsm(clk, ordersToLocalChan, maintenanceChan, loadChan, drvFloors, drvObstr, fsmStop, elevatorCh)
 
 	go localStates.LocalStateManager(
+		clk,
 		drvButtons,
 		elevatorCh,
 		outgoingLocalOrdersChan,
@@ -69,17 +170,260 @@ func main() {
 	)
 
 	go networkOrders.NetworkOrderManager(
+		clk,
 		*elevatorID,
 		outgoingLocalElevStateChan,
 		outgoingLocalOrdersChan,
 		completedRequetsChan,
 		incomingNetworkData,
 		outgoingNetworkData,
-		requestsToLocalChan,
+		ordersToLocalChan,
+		parkingStrategy,
+		trafficSource,
+		recallChan,
+		destinationChan,
 	)
 
-	go broadcastState.BroadcastState(outgoingNetworkData, *broadcastPortFlag)
-	go broadcastState.ReceiveState(incomingNetworkData, *broadcastPortFlag)
+	go broadcastState.BroadcastState(clk, outgoingNetworkData, transport, *clusterID, security)
+	go broadcastState.ReceiveState(clk, incomingNetworkData, transport, *clusterID, security)
+
+	if *httpAddr != "" {
+		go statusAPI.Serve(*httpAddr, map[string]statusAPI.Source{
+			"/clusters":     func() interface{} { return broadcastState.VisibleClusters(clk.Now()) },
+			"/stats":        func() interface{} { return broadcastState.GetStats() },
+			"/orders":       func() interface{} { return networkOrders.GetStatus() },
+			"/eta":          func() interface{} { return networkOrders.GetETAs(clk.Now()) },
+			"/maintenance":  maintenanceCtl.get,
+			"/recall":       func() interface{} { return networkOrders.GetStatus().Recall },
+			"/load":         load.get,
+			"/destinations": func() interface{} { return networkOrders.GetStatus().Destinations },
+			"/audit":        func() interface{} { return networkOrders.GetAudit() },
+			"/audit.csv": func() interface{} {
+				return statusAPI.Text{ContentType: "text/csv", Body: networkOrders.AuditCSV()}
+			},
+			"/audit.jsonl": func() interface{} {
+				return statusAPI.Text{ContentType: "application/x-ndjson", Body: networkOrders.AuditJSONLines()}
+			},
+		}, map[string]statusAPI.Action{
+			"/maintenance":  maintenanceCtl.post,
+			"/recall":       recallAction(recallChan),
+			"/load":         load.post,
+			"/destinations": destinationAction(destinationChan),
+			"/calls":        callAction(outgoingLocalOrdersChan),
+			"/cancel":       cancelAction(outgoingLocalOrdersChan),
+		})
+	}
 
 	select {}
 }
+
+// loadSecurity reads the cluster keys named on the command line. Empty
+// file names leave that protection off.
+func loadSecurity(keyFile string, encKeyFile string, prevEncKeyFile string) (broadcastState.Security, error) {
+	var security broadcastState.Security
+	var err error
+	if keyFile != "" {
+		if security.AuthKey, err = broadcastState.LoadKey(keyFile); err != nil {
+			return security, err
+		}
+	}
+	if encKeyFile == "" {
+		if prevEncKeyFile != "" {
+			return security, fmt.Errorf("-enckey-prev given without -enckey")
+		}
+		return security, nil
+	}
+	current, err := broadcastState.LoadKey(encKeyFile)
+	if err != nil {
+		return security, err
+	}
+	var previous []byte
+	if prevEncKeyFile != "" {
+		if previous, err = broadcastState.LoadKey(prevEncKeyFile); err != nil {
+			return security, err
+		}
+	}
+	security.Encryption, err = broadcastState.NewEncryption(current, previous)
+	return security, err
+}
+
+// maintenanceControl passes maintenance settings from the command line and
+// the status API on to the FSM, and remembers the last one. It is not locked
+// while the FSM is busy, only send is, which keeps the settings in order.
+type maintenanceControl struct {
+	sync.Mutex
+	send    sync.Mutex
+	current structs.Maintenance
+	ch      chan<- structs.Maintenance
+}
+
+func (c *maintenanceControl) get() interface{} {
+	c.Lock()
+	defer c.Unlock()
+	return c.current
+}
+
+func (c *maintenanceControl) set(setting structs.Maintenance) {
+	c.send.Lock()
+	defer c.send.Unlock()
+	c.Lock()
+	c.current = setting
+	c.Unlock()
+	c.ch <- setting
+}
+
+// post takes a JSON body like {"on": true, "floor": 2}. Without a floor the
+// elevator stays where it is.
+func (c *maintenanceControl) post(body []byte) (interface{}, error) {
+	setting := structs.Maintenance{Floor: -1}
+	if err := json.Unmarshal(body, &setting); err != nil {
+		return nil, err
+	}
+	if setting.Floor < -1 || setting.Floor >= config.N_FLOORS {
+		return nil, fmt.Errorf("no floor %d", setting.Floor)
+	}
+	c.set(setting)
+	return setting, nil
+}
+
+// recallAction starts fire service recall for {"active": true} and resets
+// it for {"active": false}. Either way it reaches every elevator.
+func recallAction(recallChan chan<- bool) statusAPI.Action {
+	return func(body []byte) (interface{}, error) {
+		var setting struct {
+			Active *bool `json:"active"`
+		}
+		if err := json.Unmarshal(body, &setting); err != nil {
+			return nil, err
+		}
+		if setting.Active == nil {
+			return nil, fmt.Errorf("active must be given")
+		}
+		recallChan <- *setting.Active
+		return setting, nil
+	}
+}
+
+// loadSensor stands in for a weight sensor in the car. Its reading is set
+// through the status API, e.g. {"kg": 650}. It is not locked while the FSM
+// is busy, only send is, which keeps the readings in order.
+type loadSensor struct {
+	sync.Mutex
+	send    sync.Mutex
+	reading loadReading
+	ch      chan<- int
+}
+
+type loadReading struct {
+	Kg   int  `json:"kg"`
+	Full bool `json:"full"`
+}
+
+func (l *loadSensor) get() interface{} {
+	l.Lock()
+	defer l.Unlock()
+	return l.reading
+}
+
+func (l *loadSensor) post(body []byte) (interface{}, error) {
+	var reading loadReading
+	if err := json.Unmarshal(body, &reading); err != nil {
+		return nil, err
+	}
+	if reading.Kg < 0 {
+		return nil, fmt.Errorf("load %d kg is negative", reading.Kg)
+	}
+	reading.Full = reading.Kg >= config.FullLoadKg
+	l.send.Lock()
+	defer l.send.Unlock()
+	l.Lock()
+	l.reading = reading
+	l.Unlock()
+	l.ch <- reading.Kg
+	return reading, nil
+}
+
+// destinationAction takes a call from a destination keypad, e.g.
+// {"from": 0, "to": 3}, and answers with the car to board. If the master has
+// not chosen one within a second the car is left empty, and the caller can
+// look the call up in /destinations.
+func destinationAction(destinationChan chan<- networkOrders.DestinationRequest) statusAPI.Action {
+	return func(body []byte) (interface{}, error) {
+		var trip struct {
+			From *int `json:"from"`
+			To   *int `json:"to"`
+		}
+		if err := json.Unmarshal(body, &trip); err != nil {
+			return nil, err
+		}
+		if trip.From == nil || trip.To == nil {
+			return nil, fmt.Errorf("from and to must be given")
+		}
+		reply := make(chan networkOrders.DestinationRow, 1)
+		destinationChan <- networkOrders.DestinationRequest{From: *trip.From, To: *trip.To, Reply: reply}
+		row := <-reply
+		if row.ID == "" {
+			return nil, fmt.Errorf("no trip from floor %d to %d", *trip.From, *trip.To)
+		}
+		return row, nil
+	}
+}
+
+// callAction places a hall call with a priority, standing in for a key card
+// reader at the hall buttons, e.g. {"floor": 2, "dir": "up", "priority": "exclusive"}.
+func callAction(localOrdersChan chan<- structs.HallOrder) statusAPI.Action {
+	return func(body []byte) (interface{}, error) {
+		var call struct {
+			Floor    int    `json:"floor"`
+			Dir      string `json:"dir"`
+			Priority string `json:"priority"`
+		}
+		if err := json.Unmarshal(body, &call); err != nil {
+			return nil, err
+		}
+		dir, err := hallButton(call.Floor, call.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if call.Priority == "" {
+			call.Priority = structs.PriorityNormal.String()
+		}
+		priority, err := structs.ParsePriority(call.Priority)
+		if err != nil {
+			return nil, err
+		}
+		localOrdersChan <- structs.HallOrder{Floor: call.Floor, Dir: dir, Priority: priority}
+		return call, nil
+	}
+}
+
+// cancelAction takes back the hall call given like {"floor": 2, "dir": "up"},
+// the same as pressing its button twice.
+func cancelAction(localOrdersChan chan<- structs.HallOrder) statusAPI.Action {
+	return func(body []byte) (interface{}, error) {
+		var call struct {
+			Floor int    `json:"floor"`
+			Dir   string `json:"dir"`
+		}
+		if err := json.Unmarshal(body, &call); err != nil {
+			return nil, err
+		}
+		dir, err := hallButton(call.Floor, call.Dir)
+		if err != nil {
+			return nil, err
+		}
+		localOrdersChan <- structs.HallOrder{Status: structs.Cancelled, Floor: call.Floor, Dir: dir}
+		return call, nil
+	}
+}
+
+// hallButton returns the hall button for dir, "up" or "down", if floor has one.
+func hallButton(floor int, dir string) (elevio.ButtonType, error) {
+	switch {
+	case dir == "up" && floor >= 0 && floor < config.N_FLOORS-1:
+		return elevio.BT_HallUp, nil
+	case dir == "down" && floor > 0 && floor < config.N_FLOORS:
+		return elevio.BT_HallDown, nil
+	}
+	return 0, fmt.Errorf("no %q button on floor %d", dir, floor)
+}
@@ -0,0 +1,112 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/structs"
+	"time"
+)
+
+// An ETA only changes when the estimate moves by more than this, so orders
+// are not rebroadcast every tick.
+const etaTolerance = time.Second
+
+// Number of served orders kept to compare predicted with actual arrival.
+const arrivalHistory = 20
+
+// ArrivalSample is an order served by this elevator, with when it was
+// predicted to arrive and when it did.
+type ArrivalSample struct {
+	Floor     int       `json:"floor"`
+	Dir       string    `json:"dir"`
+	Predicted time.Time `json:"predicted"`
+	Actual    time.Time `json:"actual"`
+	ErrorMs   int64     `json:"errorMs"`
+}
+
+// ETAAccuracy sums up how well the ETAs of the orders served by this elevator held.
+type ETAAccuracy struct {
+	Samples        uint64          `json:"samples"`
+	MeanErrorMs    float64         `json:"meanErrorMs"`
+	MeanAbsErrorMs float64         `json:"meanAbsErrorMs"`
+	Recent         []ArrivalSample `json:"recent"`
+}
+
+// arrivals is kept in a fixed array, so copies of the order manager do not share it.
+type arrivals struct {
+	samples     uint64
+	sumError    int64
+	sumAbsError int64
+	recent      [arrivalHistory]ArrivalSample
+}
+
+// setETAs stamps the assigned orders in view with when their elevator is
+// expected at the floor.
+func (m *orderManager) setETAs(view structs.ElevatorDataWithID, now time.Time) {
+	for i, order := range view.HallOrders {
+		if order.Status != structs.Assigned {
+			view.HallOrders[i].ETA = 0
+			continue
+		}
+		estimate := toMillis(now.Add(estimatedServiceTime(view, order)))
+		if j := findOrder(m.hallOrders, order.Floor, order.Dir); j >= 0 {
+			prev := m.hallOrders[j]
+			diff := time.Duration(prev.ETA-estimate) * time.Millisecond
+			if prev.ETA != 0 && prev.DelegatedID == order.DelegatedID && prev.Presses.Equal(order.Presses) &&
+				diff <= etaTolerance && diff >= -etaTolerance {
+				estimate = prev.ETA
+			}
+		}
+		view.HallOrders[i].ETA = estimate
+	}
+}
+
+// recordArrival compares the ETA of an order the local elevator has just served with the time it did.
+func (m *orderManager) recordArrival(order structs.HallOrder, now time.Time) {
+	if order.Status != structs.Assigned || order.DelegatedID != m.localID || order.ETA == 0 {
+		return
+	}
+	predicted := fromMillis(order.ETA)
+	errMs := toMillis(now) - order.ETA
+	a := &m.arrivals
+	a.recent[a.samples%arrivalHistory] = ArrivalSample{
+		Floor:     order.Floor,
+		Dir:       dirName(order.Dir),
+		Predicted: predicted,
+		Actual:    now,
+		ErrorMs:   errMs,
+	}
+	a.samples++
+	a.sumError += errMs
+	if errMs < 0 {
+		errMs = -errMs
+	}
+	a.sumAbsError += errMs
+}
+
+func (a *arrivals) accuracy() ETAAccuracy {
+	acc := ETAAccuracy{Samples: a.samples, Recent: make([]ArrivalSample, 0, arrivalHistory)}
+	if a.samples == 0 {
+		return acc
+	}
+	acc.MeanErrorMs = float64(a.sumError) / float64(a.samples)
+	acc.MeanAbsErrorMs = float64(a.sumAbsError) / float64(a.samples)
+	// Oldest first
+	for k := uint64(0); k < arrivalHistory; k++ {
+		if a.samples < arrivalHistory && k >= a.samples {
+			break
+		}
+		i := k
+		if a.samples > arrivalHistory {
+			i = (a.samples + k) % arrivalHistory
+		}
+		acc.Recent = append(acc.Recent, a.recent[i])
+	}
+	return acc
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
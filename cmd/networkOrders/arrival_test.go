@@ -0,0 +1,54 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestETAsAreSetAndSticky(t *testing.T) {
+	master, peer := handoffPair()
+	data := tickAt(master, peer, mcEpoch)
+	want := toMillis(mcEpoch.Add(time.Duration(config.TravelDuration_s * float64(time.Second))))
+	if got := data.HallOrders[0].ETA; got != want {
+		t.Fatalf("ETA %v, want %v", fromMillis(got), fromMillis(want))
+	}
+
+	// The car has not moved, so the estimate slips, but within the tolerance the ETA stays put
+	data = tickAt(master, peer, mcEpoch.Add(etaTolerance/2))
+	if got := data.HallOrders[0].ETA; got != want {
+		t.Errorf("ETA moved to %v within the tolerance", fromMillis(got))
+	}
+	data = tickAt(master, peer, mcEpoch.Add(2*etaTolerance))
+	if got := data.HallOrders[0].ETA; got == want {
+		t.Errorf("ETA did not move when the estimate did")
+	}
+
+	peer.handleIncoming(data, mcEpoch)
+	if got := peer.hallOrders[0].ETA; got != data.HallOrders[0].ETA {
+		t.Errorf("peer has ETA %v, master says %v", fromMillis(got), fromMillis(data.HallOrders[0].ETA))
+	}
+}
+
+func TestArrivalAccuracy(t *testing.T) {
+	m := mcNewNode(0)
+	predicted := mcEpoch.Add(time.Hour)
+	order := structs.HallOrder{Floor: 2, Dir: elevio.BT_HallDown, Status: structs.Assigned, DelegatedID: m.localID, ETA: toMillis(predicted)}
+	for k := 0; k < arrivalHistory+5; k++ {
+		m.hallOrders = []structs.HallOrder{order}
+		m.handleCompleted([]elevio.ButtonEvent{{Floor: 2, Button: elevio.BT_HallDown}}, predicted.Add(time.Duration(k)*time.Second))
+	}
+
+	acc := m.arrivals.accuracy()
+	if acc.Samples != arrivalHistory+5 || len(acc.Recent) != arrivalHistory {
+		t.Fatalf("got %d samples and %d recent", acc.Samples, len(acc.Recent))
+	}
+	if acc.Recent[0].ErrorMs != 5000 || acc.Recent[arrivalHistory-1].ErrorMs != (arrivalHistory+4)*1000 {
+		t.Errorf("recent samples out of order: first %d ms, last %d ms", acc.Recent[0].ErrorMs, acc.Recent[arrivalHistory-1].ErrorMs)
+	}
+	if acc.MeanAbsErrorMs != acc.MeanErrorMs || acc.MeanErrorMs <= 0 {
+		t.Errorf("mean error %v, mean absolute error %v", acc.MeanErrorMs, acc.MeanAbsErrorMs)
+	}
+}
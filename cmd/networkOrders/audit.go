@@ -0,0 +1,216 @@
+package networkOrders
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Every elevator keeps an audit trail of the hall calls it hears of: who
+// pressed the button and when, when the call was confirmed, each assignment
+// and the master that made it, and when it was served or cancelled. Only the
+// newest config.AuditLogSize events are kept.
+
+// AuditEvent is one step in the life of a hall call. Call numbers the calls
+// this elevator has heard of, so the events of one call can be told apart
+// from those of the next call on the same button. Presses are stamped with
+// the time on the elevator they were made on, everything else with when this
+// elevator learned of it. Master is the master that made an assignment, as
+// carried with the order.
+type AuditEvent struct {
+	Call        uint64    `json:"call"`
+	Time        time.Time `json:"time"`
+	Floor       int       `json:"floor"`
+	Dir         string    `json:"dir"`
+	Event       string    `json:"event"`
+	Node        string    `json:"node,omitempty"`
+	DelegatedID string    `json:"delegatedId,omitempty"`
+	Master      string    `json:"master,omitempty"`
+}
+
+// AuditCall is the history of one hall call. TookMs is the time from the
+// first event until it was served or cancelled, 0 while it is still waiting.
+type AuditCall struct {
+	Call   uint64       `json:"call"`
+	Floor  int          `json:"floor"`
+	Dir    string       `json:"dir"`
+	TookMs int64        `json:"tookMs,omitempty"`
+	Events []AuditEvent `json:"events"`
+}
+
+// auditTrail is the order manager's part of the trail: the orders as they
+// were last logged, the call each button is on, and the events logged since
+// the trail was last published.
+type auditTrail struct {
+	last   map[orderKey]structs.HallOrder
+	calls  map[orderKey]uint64
+	next   uint64
+	log    auditLog
+	recent []AuditEvent
+}
+
+// auditLog is a ring buffer of the newest config.AuditLogSize events.
+type auditLog struct {
+	events []AuditEvent
+	added  uint64
+}
+
+func (l *auditLog) add(event AuditEvent) {
+	if len(l.events) < config.AuditLogSize {
+		l.events = append(l.events, event)
+	} else {
+		l.events[l.added%config.AuditLogSize] = event
+	}
+	l.added++
+}
+
+// ordered returns a copy of the events, oldest first.
+func (l *auditLog) ordered() []AuditEvent {
+	events := make([]AuditEvent, 0, len(l.events))
+	start := 0
+	if len(l.events) == config.AuditLogSize {
+		start = int(l.added % config.AuditLogSize)
+	}
+	events = append(events, l.events[start:]...)
+	return append(events, l.events[:start]...)
+}
+
+var currentAudit = struct {
+	sync.Mutex
+	log auditLog
+}{}
+
+// recordAudit logs how the orders have changed since it was last run.
+func (m *orderManager) recordAudit(now time.Time) {
+	for _, order := range m.hallOrders {
+		key := orderKey{order.Floor, order.Dir}
+		prev, seen := m.audit.last[key]
+		m.audit.last[key] = order
+		if !seen && ended(order.Status) {
+			// Served before this elevator heard of it
+			continue
+		}
+
+		status := prev.Status
+		if !seen || (ended(prev.Status) && !ended(order.Status)) {
+			m.audit.next++
+			m.audit.calls[key] = m.audit.next
+			status = structs.Unknown
+		}
+		event := AuditEvent{Call: m.audit.calls[key], Time: now, Floor: order.Floor, Dir: dirName(order.Dir)}
+
+		// Old entries stay in the vector, so only presses newer than those logged are new
+		ids := make([]string, 0, len(order.Presses))
+		for id := range order.Presses {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if stamp := order.Presses[id]; stamp > prev.Presses[id] {
+				pressed := event
+				pressed.Time = fromMillis(stamp)
+				pressed.Event = "pressed"
+				pressed.Node = id
+				m.addAuditEvent(pressed)
+			}
+		}
+
+		switch {
+		case order.Status == status && (status != structs.Assigned || order.DelegatedID == prev.DelegatedID):
+			continue
+		case order.Status == structs.Confirmed:
+			event.Event = "confirmed"
+		case order.Status == structs.Assigned:
+			event.Event = "assigned"
+			event.DelegatedID = order.DelegatedID
+			event.Master = order.AssignedBy
+		case order.Status == structs.Completed:
+			event.Event = "completed"
+			event.DelegatedID = order.DelegatedID
+		case order.Status == structs.Cancelled:
+			event.Event = "cancelled"
+		default:
+			continue
+		}
+		m.addAuditEvent(event)
+	}
+
+	if len(m.audit.recent) > 0 {
+		currentAudit.Lock()
+		for _, event := range m.audit.recent {
+			currentAudit.log.add(event)
+		}
+		currentAudit.Unlock()
+		m.audit.recent = m.audit.recent[:0]
+	}
+}
+
+func (m *orderManager) addAuditEvent(event AuditEvent) {
+	m.audit.log.add(event)
+	m.audit.recent = append(m.audit.recent, event)
+}
+
+// GetAuditEvents returns the audit trail, oldest event first.
+func GetAuditEvents() []AuditEvent {
+	currentAudit.Lock()
+	defer currentAudit.Unlock()
+	return currentAudit.log.ordered()
+}
+
+// GetAudit returns the audit trail grouped by call, oldest call first.
+func GetAudit() []AuditCall {
+	return auditCalls(GetAuditEvents())
+}
+
+func auditCalls(events []AuditEvent) []AuditCall {
+	calls := make([]AuditCall, 0)
+	index := make(map[uint64]int)
+	for _, event := range events {
+		i, ok := index[event.Call]
+		if !ok {
+			i = len(calls)
+			index[event.Call] = i
+			calls = append(calls, AuditCall{Call: event.Call, Floor: event.Floor, Dir: event.Dir})
+		}
+		call := &calls[i]
+		call.Events = append(call.Events, event)
+		if event.Event == "completed" || event.Event == "cancelled" {
+			call.TookMs = toMillis(event.Time) - toMillis(call.Events[0].Time)
+		}
+	}
+	return calls
+}
+
+// AuditCSV returns the audit trail as CSV with a header line.
+func AuditCSV() []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"call", "time", "floor", "dir", "event", "node", "delegatedId", "master"})
+	for _, e := range GetAuditEvents() {
+		w.Write([]string{fmt.Sprint(e.Call), e.Time.Format(time.RFC3339Nano), fmt.Sprint(e.Floor), e.Dir,
+			e.Event, e.Node, e.DelegatedID, e.Master})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Println("Error writing audit CSV:", err)
+	}
+	return b.Bytes()
+}
+
+// AuditJSONLines returns the audit trail as one JSON object per line.
+func AuditJSONLines() []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range GetAuditEvents() {
+		if err := enc.Encode(e); err != nil {
+			fmt.Println("Error encoding audit event:", err)
+		}
+	}
+	return b.Bytes()
+}
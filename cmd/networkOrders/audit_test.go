@@ -0,0 +1,130 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"bytes"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func auditEvents(events []AuditEvent) []string {
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Event)
+	}
+	return names
+}
+
+func TestAuditTrailFollowsCall(t *testing.T) {
+	master, peer := handoffPair()
+	master.hallOrders = []structs.HallOrder{}
+	peer.hallOrders = []structs.HallOrder{}
+
+	peer.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch.Add(time.Second))
+	master.handleIncoming(tableOf(peer), mcEpoch)
+	master.recordAudit(mcEpoch)
+	// As the master does once every elevator has reported the press
+	master.hallOrders = applyNewOrderBarrier(master.hallOrders, map[string][]structs.HallOrder{
+		master.localID: cloneOrders(master.hallOrders),
+		peer.localID:   cloneOrders(peer.hallOrders),
+	}, master.ipMap)
+	master.recordAudit(mcEpoch)
+	data := tickAt(master, peer, mcEpoch)
+	master.recordAudit(mcEpoch)
+
+	// Served by the peer it was assigned to
+	served := mcEpoch.Add(6 * time.Second)
+	peer.handleIncoming(data, mcEpoch)
+	peer.handleCompleted([]elevio.ButtonEvent{mcCall}, served)
+	master.handleIncoming(tableOf(peer), served)
+	master.recordAudit(served)
+
+	calls := auditCalls(master.audit.log.ordered())
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1: %+v", len(calls), calls)
+	}
+	got := auditEvents(calls[0].Events)
+	want := []string{"pressed", "confirmed", "assigned", "completed"}
+	if len(got) != len(want) {
+		t.Fatalf("events %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("events %v, want %v", got, want)
+		}
+	}
+	events := calls[0].Events
+	if events[0].Node != peer.localID {
+		t.Errorf("press logged for %s, want %s", events[0].Node, peer.localID)
+	}
+	assigned := data.HallOrders[0].DelegatedID
+	if events[2].DelegatedID != assigned || events[2].Master != master.localID {
+		t.Errorf("assignment logged as %+v, want to %s by %s", events[2], assigned, master.localID)
+	}
+	if calls[0].TookMs != 5000 {
+		t.Errorf("call took %d ms, want 5000", calls[0].TookMs)
+	}
+
+	// Pressing again starts a new call, without the old press
+	master.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button}, served.Add(time.Second))
+	master.recordAudit(served.Add(time.Second))
+	calls = auditCalls(master.audit.log.ordered())
+	if len(calls) != 2 || len(calls[1].Events) != 1 || calls[1].Events[0].Node != master.localID {
+		t.Errorf("second call logged as %+v", calls)
+	}
+
+	if csv := AuditCSV(); !bytes.HasPrefix(csv, []byte("call,time,floor,dir,event")) || bytes.Count(csv, []byte("\n")) != len(master.audit.log.events)+1 {
+		t.Errorf("CSV export:\n%s", csv)
+	}
+	if lines := AuditJSONLines(); bytes.Count(lines, []byte("\n")) != len(master.audit.log.events) {
+		t.Errorf("JSON lines export:\n%s", lines)
+	}
+}
+
+func TestAuditTrailIsBounded(t *testing.T) {
+	m := mcNewNode(0)
+	now := mcEpoch
+	for i := 0; i < config.AuditLogSize; i++ {
+		now = now.Add(time.Second)
+		m.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button}, now)
+		m.recordAudit(now)
+		m.handleLocalOrder(structs.HallOrder{Status: structs.Cancelled, Floor: mcCall.Floor, Dir: mcCall.Button}, now)
+		m.recordAudit(now)
+	}
+	events := m.audit.log.ordered()
+	if len(events) != config.AuditLogSize {
+		t.Fatalf("kept %d events, want %d", len(events), config.AuditLogSize)
+	}
+	if last := events[len(events)-1]; last.Event != "cancelled" || last.Call != uint64(config.AuditLogSize) {
+		t.Errorf("newest event is %+v", last)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Fatalf("event %d is older than the one before it", i)
+		}
+	}
+	if published := GetAuditEvents(); len(published) != len(events) || published[len(published)-1] != events[len(events)-1] {
+		t.Errorf("published %d events, want the same %d as the trail", len(published), len(events))
+	}
+}
+
+func TestAuditNamesTheAssigningMaster(t *testing.T) {
+	master, peer := handoffPair()
+	peer.handleIncoming(tickAt(master, peer, mcEpoch), mcEpoch)
+
+	// A third elevator that has never heard the master learns of the assignment from the peer
+	other := mcNewNode(2)
+	other.handleIncoming(tableOf(peer), mcEpoch)
+	other.recordAudit(mcEpoch)
+	var assigned []AuditEvent
+	for _, e := range other.audit.log.ordered() {
+		if e.Event == "assigned" {
+			assigned = append(assigned, e)
+		}
+	}
+	if len(assigned) != 1 || assigned[0].Master != master.localID || assigned[0].DelegatedID != peer.localID {
+		t.Errorf("assignment logged as %+v, want to %s by %s", assigned, peer.localID, master.localID)
+	}
+}
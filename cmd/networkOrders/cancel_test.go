@@ -0,0 +1,109 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestCancelledCallReachesEveryElevator(t *testing.T) {
+	master, peer := handoffPair()
+	assigned := tickAt(master, peer, mcEpoch)
+	peer.handleIncoming(assigned, mcEpoch)
+	if !getMyRequests(peer.hallOrders, peer.elevatorStates, peer.localID)[mcCall.Floor][mcCall.Button] {
+		t.Fatalf("peer was not given the order")
+	}
+
+	// Cancelled on the master, which the call was not assigned to
+	master.handleLocalOrder(structs.HallOrder{Status: structs.Cancelled, Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch)
+	now := mcEpoch.Add(config.TransmitTickerMs * time.Millisecond)
+	data := tickAt(master, peer, now)
+	if hallLights(data)[mcCall.Floor][mcCall.Button] {
+		t.Errorf("master still lights the cancelled call")
+	}
+
+	peer.handleIncoming(data, now)
+	if got := peer.hallOrders[0].Status; got != structs.Cancelled {
+		t.Fatalf("peer has the call as %v", got)
+	}
+	if getMyRequests(peer.hallOrders, peer.elevatorStates, peer.localID)[mcCall.Floor][mcCall.Button] {
+		t.Errorf("cancelled call still among the peer's requests")
+	}
+	if hallLights(peer.networkData(now))[mcCall.Floor][mcCall.Button] {
+		t.Errorf("peer still lights the cancelled call")
+	}
+
+	// A late copy of the assignment does not bring the call back
+	peer.handleIncoming(assigned, now)
+	master.handleIncoming(assigned, now)
+	if peer.hallOrders[0].Status != structs.Cancelled || master.hallOrders[0].Status != structs.Cancelled {
+		t.Errorf("late assignment revived the call: peer %v, master %v", peer.hallOrders[0].Status, master.hallOrders[0].Status)
+	}
+}
+
+func TestCancelFromPeerAndPressAgain(t *testing.T) {
+	master, peer := handoffPair()
+	peer.handleIncoming(tickAt(master, peer, mcEpoch), mcEpoch)
+
+	peer.handleLocalOrder(structs.HallOrder{Status: structs.Cancelled, Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch)
+	master.handleIncoming(tableOf(peer), mcEpoch)
+	if got := master.hallOrders[0].Status; got != structs.Cancelled {
+		t.Fatalf("master did not take the cancellation from the peer, has %v", got)
+	}
+
+	// Cancelling again does nothing, and a new press starts a new call
+	peer.handleLocalOrder(structs.HallOrder{Status: structs.Cancelled, Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch)
+	peer.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch.Add(time.Second))
+	master.handleIncoming(tableOf(peer), mcEpoch)
+	if got := master.hallOrders[0].Status; got != structs.New {
+		t.Errorf("pressing after a cancellation gave %v, want New", got)
+	}
+}
+
+func TestRepeatPressKeepsAssignedCall(t *testing.T) {
+	master, peer := handoffPair()
+	peer.handleIncoming(tickAt(master, peer, mcEpoch), mcEpoch)
+	assigned := peer.hallOrders[0]
+	if assigned.Status != structs.Assigned {
+		t.Fatalf("peer has the call as %v", assigned.Status)
+	}
+
+	peer.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch.Add(time.Second))
+	if got := peer.hallOrders[0]; got.Status != structs.Assigned || got.DelegatedID != assigned.DelegatedID {
+		t.Errorf("repeat press reset the call to %+v", got)
+	}
+	if !hallLights(peer.networkData(mcEpoch.Add(time.Second)))[mcCall.Floor][mcCall.Button] {
+		t.Errorf("repeat press turned the lamp off")
+	}
+
+	// A priority press is a new request
+	peer.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button, Priority: structs.PriorityHigh}, mcEpoch.Add(2*time.Second))
+	if got := peer.hallOrders[0]; got.Status != structs.New || got.Priority != structs.PriorityHigh {
+		t.Errorf("priority press gave %+v", got)
+	}
+}
+
+func TestRecallCancelsOrdersAndDestinationCalls(t *testing.T) {
+	master, peer := handoffPair()
+	peer.handleIncoming(tickAt(master, peer, mcEpoch), mcEpoch)
+	now := mcEpoch.Add(time.Second)
+	id, err := peer.addDestination(0, 3, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange(peer, master, now)
+	exchange(master, peer, now)
+
+	master.setRecall(true, now)
+	exchange(master, peer, now)
+	for _, m := range []*orderManager{master, peer} {
+		if got := m.hallOrders[0].Status; got != structs.Cancelled {
+			t.Errorf("%s has the hall call as %v after recall", m.localID, got)
+		}
+		i := findDestination(m.dest.calls, id)
+		if i < 0 || m.dest.calls[i].Status != structs.Cancelled {
+			t.Errorf("%s did not cancel the destination call: %+v", m.localID, m.dest.calls)
+		}
+	}
+}
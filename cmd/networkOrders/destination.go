@@ -0,0 +1,333 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"fmt"
+	"sanntids/cmd/config"
+	"sanntids/cmd/eta"
+	"sanntids/cmd/structs"
+	"sanntids/cmd/util"
+	"sort"
+	"time"
+)
+
+// Destination keypads let a passenger enter the floor they are going to
+// instead of pressing up or down. Each call gets its own ID and is kept in a
+// table next to the hall orders, broadcast the same way. The master assigns
+// it to a car, preferring a car that already picks up passengers going to
+// nearby floors, and that car gets a hall stop at the origin. When it has
+// stopped there, the destination becomes one of its cab calls and the call
+// is completed.
+
+// DestinationRequest is a call entered on a destination keypad. The new call
+// is sent on Reply once the master has given it a car, or as it is after
+// config.DestinationReplyMs. A call that is refused is sent with no ID.
+type DestinationRequest struct {
+	From  int
+	To    int
+	Reply chan<- DestinationRow
+}
+
+// destinationReply is a request waiting for its call to get a car.
+type destinationReply struct {
+	id       string
+	reply    chan<- DestinationRow
+	deadline time.Time
+}
+
+// destinations is the local part of destination dispatch.
+type destinations struct {
+	calls []structs.DestinationCall
+	// cabStops are destinations of picked up passengers that the FSM has not taken as cab calls yet
+	cabStops [config.N_FLOORS]bool
+	// done holds the IDs of pruned calls, so old copies are not taken up again
+	done    map[string]time.Time
+	next    uint64
+	replies []destinationReply
+}
+
+// addDestination adds a call entered on this elevator's keypad.
+func (m *orderManager) addDestination(from int, to int, now time.Time) (string, error) {
+	if from < 0 || from >= config.N_FLOORS || to < 0 || to >= config.N_FLOORS || from == to {
+		return "", fmt.Errorf("no trip from floor %d to %d", from, to)
+	}
+	if m.recall.Active {
+		return "", fmt.Errorf("no service during fire recall")
+	}
+	m.dest.next++
+	call := structs.DestinationCall{
+		ID:      fmt.Sprintf("%s-%d.%d", m.localID, toMillis(now), m.dest.next),
+		From:    from,
+		To:      to,
+		Status:  structs.New,
+		Created: toMillis(now),
+	}
+	m.dest.calls = append(m.dest.calls, call)
+	return call.ID, nil
+}
+
+// requestDestination adds the call in request, which is answered by
+// answerDestinations.
+func (m *orderManager) requestDestination(request DestinationRequest, now time.Time) {
+	id, err := m.addDestination(request.From, request.To, now)
+	if err != nil {
+		m.logf("Error in destination call: %v\n", err)
+		request.Reply <- DestinationRow{From: request.From, To: request.To}
+		return
+	}
+	m.dest.replies = append(m.dest.replies, destinationReply{
+		id:       id,
+		reply:    request.Reply,
+		deadline: now.Add(config.DestinationReplyMs * time.Millisecond),
+	})
+}
+
+// answerDestinations sends the requested calls that have a car, or have
+// waited too long for one, to their requesters.
+func (m *orderManager) answerDestinations(now time.Time) {
+	var waiting []destinationReply
+	for _, r := range m.dest.replies {
+		i := findDestination(m.dest.calls, r.id)
+		if i >= 0 && m.dest.calls[i].Car == "" && now.Before(r.deadline) {
+			waiting = append(waiting, r)
+			continue
+		}
+		row := DestinationRow{ID: r.id}
+		if i >= 0 {
+			row = destinationRow(m.dest.calls[i])
+		}
+		r.reply <- row
+	}
+	m.dest.replies = waiting
+}
+
+func destinationRow(call structs.DestinationCall) DestinationRow {
+	return DestinationRow{
+		ID:     call.ID,
+		From:   call.From,
+		To:     call.To,
+		Status: call.Status.String(),
+		Car:    call.Car,
+	}
+}
+
+func findDestination(calls []structs.DestinationCall, id string) int {
+	for i, call := range calls {
+		if call.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func destinationDir(call structs.DestinationCall) elevio.ButtonType {
+	if call.To > call.From {
+		return elevio.BT_HallUp
+	}
+	return elevio.BT_HallDown
+}
+
+// mergeDestination folds a call reported by senderID into the local table.
+// A call that got further in its lifecycle wins, and for the same status the
+// master decides which car it goes to.
+func (m *orderManager) mergeDestination(senderID string, call structs.DestinationCall) {
+	if _, pruned := m.dest.done[call.ID]; pruned {
+		return
+	}
+	i := findDestination(m.dest.calls, call.ID)
+	if i < 0 {
+		m.dest.calls = append(m.dest.calls, call)
+		return
+	}
+	local := m.dest.calls[i]
+	switch {
+	case call.Status > local.Status && local.Status.CanTransitionTo(call.Status):
+		m.dest.calls[i] = call
+	case call.Status == local.Status && call.Car != local.Car && util.IsMaster(m.ipMap, senderID):
+		m.dest.calls[i].Car = call.Car
+	}
+}
+
+// assignDestinations is run by the master. New calls, and calls whose car can
+// no longer take them, go to the car that already stops for a passenger from
+// the same floor going the same way to a nearby floor, or else to the car
+// estimated to get there first.
+func (m *orderManager) assignDestinations(hallOrders []structs.HallOrder) {
+	available := availableElevators(m.elevatorStates, m.flagged)
+	if len(available) == 0 {
+		return
+	}
+	for i, call := range m.dest.calls {
+		if ended(call.Status) {
+			continue
+		}
+		if _, ok := available[call.Car]; call.Status == structs.Assigned && ok {
+			continue
+		}
+		car := m.groupedCar(call, available)
+		if car == "" {
+			car = fastestCar(call, available, hallOrders, m.dest.calls)
+		}
+		m.dest.calls[i].Status = structs.Assigned
+		m.dest.calls[i].Car = car
+	}
+}
+
+// groupedCar returns the available car already picking up a passenger who
+// shares the trip of call, or "" if there is none.
+func (m *orderManager) groupedCar(call structs.DestinationCall, available map[string]structs.HRAElevState) string {
+	for _, other := range m.dest.calls {
+		if other.ID == call.ID || other.Status != structs.Assigned || other.From != call.From ||
+			destinationDir(other) != destinationDir(call) || abs(other.To-call.To) > config.DestinationGroupFloors {
+			continue
+		}
+		if _, ok := available[other.Car]; ok {
+			return other.Car
+		}
+	}
+	return ""
+}
+
+func fastestCar(call structs.DestinationCall, available map[string]structs.HRAElevState, hallOrders []structs.HallOrder, calls []structs.DestinationCall) string {
+	ids := make([]string, 0, len(available))
+	for id := range available {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	best := ""
+	var bestTime time.Duration
+	for _, id := range ids {
+		stops := hallRequestsOf(hallOrders, id)
+		for _, other := range calls {
+			if other.Status == structs.Assigned && other.Car == id {
+				stops[other.From][destinationDir(other)] = true
+			}
+		}
+		stops[call.From][destinationDir(call)] = true
+		t := eta.ServiceTimes(available[id], stops)[call.From][destinationDir(call)]
+		if t == eta.NotServed {
+			continue
+		}
+		if best == "" || t < bestTime {
+			best, bestTime = id, t
+		}
+	}
+	if best == "" {
+		best = ids[0]
+	}
+	return best
+}
+
+// availableElevators returns the elevators that can take calls, preferring
+// those that are not flagged and not full like assignOrders does.
+func availableElevators(states map[string]structs.HRAElevState, excluded map[string]elevatorFlag) map[string]structs.HRAElevState {
+	available := make(map[string]structs.HRAElevState)
+	for id, state := range states {
+		if !(state.Obstruction || state.Stop || state.Maintenance) {
+			available[id] = state
+		}
+	}
+	available = preferring(available, func(id string, state structs.HRAElevState) bool {
+		_, isExcluded := excluded[id]
+		return !isExcluded
+	})
+	return preferring(available, func(id string, state structs.HRAElevState) bool {
+		return state.LoadKg < config.FullLoadKg
+	})
+}
+
+// takeAllDestinations gives every open call to the local car while isolated.
+func takeAllDestinations(calls []structs.DestinationCall, localID string) {
+	for i, call := range calls {
+		if !ended(call.Status) {
+			calls[i].Status = structs.Assigned
+			calls[i].Car = localID
+		}
+	}
+}
+
+// cancelAllDestinations cancels every open call during fire recall.
+func (m *orderManager) cancelAllDestinations() {
+	for i, call := range m.dest.calls {
+		if !ended(call.Status) {
+			m.dest.calls[i].Status = structs.Cancelled
+		}
+	}
+	m.dest.cabStops = [config.N_FLOORS]bool{}
+}
+
+// destinationRequests adds the hall stops of the calls assigned to this car,
+// and the destinations of the passengers it has picked up, to requests.
+func (m *orderManager) destinationRequests(requests *[config.N_FLOORS][config.N_BUTTONS]bool) {
+	state := m.elevatorStates[m.localID]
+	for _, call := range m.dest.calls {
+		if call.Status == structs.Assigned && call.Car == m.localID && !state.Maintenance {
+			requests[call.From][destinationDir(call)] = true
+		}
+	}
+	for floor, stop := range m.dest.cabStops {
+		if stop {
+			requests[floor][elevio.BT_Cab] = true
+		}
+	}
+}
+
+// pickUp completes the calls this car has stopped for and turns their
+// destinations into cab stops.
+func (m *orderManager) pickUp(req elevio.ButtonEvent) {
+	for i, call := range m.dest.calls {
+		if call.Status == structs.Assigned && call.Car == m.localID &&
+			call.From == req.Floor && destinationDir(call) == req.Button {
+			m.dest.calls[i].Status = structs.Completed
+			m.dest.cabStops[call.To] = true
+		}
+	}
+}
+
+// updateDestinations is run every tick. Cab stops the FSM has taken are
+// dropped, and completed or cancelled calls are pruned after
+// config.DestinationKeepMs.
+func (m *orderManager) updateDestinations(now time.Time) {
+	if state, ok := m.elevatorStates[m.localID]; ok {
+		for floor, stop := range m.dest.cabStops {
+			if stop && floor < len(state.CabRequests) && state.CabRequests[floor] {
+				m.dest.cabStops[floor] = false
+			}
+		}
+	}
+
+	keep := config.DestinationKeepMs * time.Millisecond
+	var calls []structs.DestinationCall
+	for _, call := range m.dest.calls {
+		if ended(call.Status) && now.Sub(fromMillis(call.Created)) > keep {
+			m.dest.done[call.ID] = now
+			continue
+		}
+		calls = append(calls, call)
+	}
+	m.dest.calls = calls
+	for id, pruned := range m.dest.done {
+		if now.Sub(pruned) > 10*keep {
+			delete(m.dest.done, id)
+		}
+	}
+}
+
+// changedDestinations returns the calls in calls that are not in sent as they are.
+func changedDestinations(sent []structs.DestinationCall, calls []structs.DestinationCall) []structs.DestinationCall {
+	var changed []structs.DestinationCall
+	for _, call := range calls {
+		if i := findDestination(sent, call.ID); i < 0 || sent[i] != call {
+			changed = append(changed, call)
+		}
+	}
+	return changed
+}
+
+func cloneDestinations(calls []structs.DestinationCall) []structs.DestinationCall {
+	if calls == nil {
+		return nil
+	}
+	return append([]structs.DestinationCall(nil), calls...)
+}
@@ -0,0 +1,156 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+// exchange gives each of the two elevators the other's full table.
+func exchange(a *orderManager, b *orderManager, now time.Time) {
+	b.handleIncoming(a.tick(now), now)
+	a.handleIncoming(b.tick(now), now)
+}
+
+func TestDestinationCallIsAssignedAndServed(t *testing.T) {
+	master, peer := handoffPair()
+	now := mcEpoch.Add(time.Second)
+	id, err := peer.addDestination(0, 3, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange(peer, master, now)
+	exchange(master, peer, now)
+
+	i := findDestination(peer.dest.calls, id)
+	if i < 0 || peer.dest.calls[i].Status != structs.Assigned || peer.dest.calls[i].Car == "" {
+		t.Fatalf("call not assigned: %+v", peer.dest.calls)
+	}
+	car := master
+	if peer.dest.calls[i].Car == peer.localID {
+		car = peer
+	}
+
+	var requests [4][3]bool
+	car.destinationRequests(&requests)
+	if !requests[0][elevio.BT_HallUp] {
+		t.Fatalf("car has no stop at the origin")
+	}
+	car.handleCompleted([]elevio.ButtonEvent{{Floor: 0, Button: elevio.BT_HallUp}}, now)
+	requests = [4][3]bool{}
+	car.destinationRequests(&requests)
+	if !requests[3][elevio.BT_Cab] || car.dest.calls[findDestination(car.dest.calls, id)].Status != structs.Completed {
+		t.Errorf("picking up did not turn the destination into a cab call")
+	}
+
+	// Once the FSM has the cab call it is no longer added
+	state := car.elevatorStates[car.localID]
+	state.CabRequests = []bool{false, false, false, true}
+	car.elevatorStates[car.localID] = state
+	car.updateDestinations(now)
+	if car.dest.cabStops[3] {
+		t.Errorf("cab stop kept after the FSM took it")
+	}
+}
+
+func TestDestinationCallsAreGrouped(t *testing.T) {
+	master, peer := handoffPair()
+	now := mcEpoch.Add(time.Second)
+	first, _ := master.addDestination(0, 3, now)
+	master.tick(now)
+	car := master.dest.calls[findDestination(master.dest.calls, first)].Car
+
+	// Make the other car the faster one, so only grouping gives the same car
+	other := peer.localID
+	if car == peer.localID {
+		other = master.localID
+	}
+	state := master.elevatorStates[car]
+	state.Floor = 3
+	master.elevatorStates[car] = state
+	state = master.elevatorStates[other]
+	state.Floor = 0
+	master.elevatorStates[other] = state
+
+	near, _ := master.addDestination(0, 3, now)
+	far, _ := master.addDestination(0, 1, now)
+	master.tick(now)
+	if got := master.dest.calls[findDestination(master.dest.calls, near)].Car; got != car {
+		t.Errorf("passenger going to the same floor was sent to %s, want %s", got, car)
+	}
+	if got := master.dest.calls[findDestination(master.dest.calls, far)].Car; got != other {
+		t.Errorf("passenger going elsewhere was sent to %s, want the faster car %s", got, other)
+	}
+}
+
+func TestDestinationCallRejectsSameFloor(t *testing.T) {
+	m := mcNewNode(0)
+	if _, err := m.addDestination(2, 2, mcEpoch); err == nil {
+		t.Errorf("trip to the same floor accepted")
+	}
+}
+
+func TestDestinationStopLeavesOtherCarsHallCall(t *testing.T) {
+	master, peer := handoffPair()
+	peer.handleIncoming(tickAt(master, peer, mcEpoch), mcEpoch)
+	if got := peer.hallOrders[0].DelegatedID; got != peer.localID {
+		t.Fatalf("hall call assigned to %s, want %s", got, peer.localID)
+	}
+
+	// The master picks up a destination passenger where the peer holds the hall call
+	master.dest.calls = append(master.dest.calls, structs.DestinationCall{
+		ID: "trip", From: mcCall.Floor, To: 3, Status: structs.Assigned, Car: master.localID,
+	})
+	now := mcEpoch.Add(time.Second)
+	master.handleCompleted([]elevio.ButtonEvent{mcCall}, now)
+	if got := master.dest.calls[findDestination(master.dest.calls, "trip")].Status; got != structs.Completed {
+		t.Errorf("destination call is %v after the pickup", got)
+	}
+	if got := master.hallOrders[0]; got.Status != structs.Assigned || got.DelegatedID != peer.localID {
+		t.Errorf("stop completed the peer's hall call: %+v", got)
+	}
+	if !hallLights(master.networkData(now))[mcCall.Floor][mcCall.Button] {
+		t.Errorf("lamp turned off while the peer still has the call")
+	}
+}
+
+func TestDestinationRequestIsAnsweredWithItsCar(t *testing.T) {
+	master, peer := handoffPair()
+	reply := make(chan DestinationRow, 1)
+	peer.requestDestination(DestinationRequest{From: 0, To: 3, Reply: reply}, mcEpoch)
+	peer.answerDestinations(mcEpoch)
+	if len(reply) != 0 {
+		t.Fatalf("answered before the call had a car: %+v", <-reply)
+	}
+
+	exchange(peer, master, mcEpoch)
+	exchange(master, peer, mcEpoch)
+	peer.answerDestinations(mcEpoch)
+	select {
+	case row := <-reply:
+		if row.ID == "" || row.Car == "" || row.Status != structs.Assigned.String() {
+			t.Errorf("answered with %+v", row)
+		}
+	default:
+		t.Fatalf("not answered once the call had a car")
+	}
+
+	// Without a master the call is answered as it is when the time is up
+	alone := mcNewNode(0)
+	alone.requestDestination(DestinationRequest{From: 0, To: 3, Reply: reply}, mcEpoch)
+	alone.answerDestinations(mcEpoch.Add(time.Duration(config.DestinationReplyMs-1) * time.Millisecond))
+	if len(reply) != 0 {
+		t.Fatalf("answered before the time was up")
+	}
+	alone.answerDestinations(mcEpoch.Add(config.DestinationReplyMs * time.Millisecond))
+	if row := <-reply; row.ID == "" || row.Car != "" {
+		t.Errorf("answered with %+v", row)
+	}
+
+	alone.requestDestination(DestinationRequest{From: 2, To: 2, Reply: reply}, mcEpoch)
+	if row := <-reply; row.ID != "" {
+		t.Errorf("trip to the same floor answered with %+v", row)
+	}
+}
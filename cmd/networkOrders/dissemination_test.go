@@ -0,0 +1,132 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestChangesGoOutWithoutRunningTheAssigner(t *testing.T) {
+	master, peer := handoffPair()
+	runs := 0
+	master.assign = func(data structs.ElevatorDataWithID) structs.ElevatorDataWithID {
+		runs++
+		return mcAssign(data)
+	}
+	tickAt(master, peer, mcEpoch)
+	runs = 0
+
+	out := make(chan structs.ElevatorDataWithID, 1)
+	now := mcEpoch.Add(time.Millisecond)
+	master.handleLocalOrder(structs.HallOrder{Floor: 3, Dir: mcCall.Button}, now)
+	master.publishChanges(now, out)
+	msg := <-out
+	if i := findOrder(msg.HallOrders, 3, mcCall.Button); i < 0 || msg.HallOrders[i].Status != structs.New {
+		t.Errorf("new press not sent as it is: %+v", msg.HallOrders)
+	}
+
+	state := master.elevatorStates[master.localID]
+	state.Floor = 2
+	master.elevatorStates[master.localID] = state
+	master.publishChanges(now, out)
+	<-out
+	master.publishChanges(now, out)
+	if len(out) != 0 || master.unsent() {
+		t.Errorf("nothing changed but a message was sent")
+	}
+	if runs != 0 {
+		t.Errorf("assigner run %d times between ticks", runs)
+	}
+}
+
+// pressAndPublish presses the hall call at floor on m and returns the message
+// it sends for it.
+func pressAndPublish(m *orderManager, floor int, now time.Time) structs.ElevatorDataWithID {
+	out := make(chan structs.ElevatorDataWithID, 1)
+	m.handleLocalOrder(structs.HallOrder{Floor: floor, Dir: mcCall.Button}, now)
+	m.publishChanges(now, out)
+	return <-out
+}
+
+func TestDeltaIsAppliedOverSnapshot(t *testing.T) {
+	master, peer := handoffPair()
+	out := make(chan structs.ElevatorDataWithID, 1)
+	peer.publish(peer.localData(), mcEpoch, out)
+	snapshot := <-out
+	if snapshot.Kind != structs.Snapshot {
+		t.Fatalf("first message is %v, want a Snapshot", snapshot.Kind)
+	}
+	if master.handleIncoming(snapshot, mcEpoch) {
+		t.Errorf("snapshot asked for another one")
+	}
+
+	delta := pressAndPublish(peer, 3, mcEpoch.Add(time.Millisecond))
+	if delta.Kind != structs.Delta || delta.Seq != snapshot.Seq+1 || len(delta.HallOrders) != 1 {
+		t.Fatalf("press sent as %+v, want a Delta with the one order", delta)
+	}
+	if master.handleIncoming(delta, mcEpoch) {
+		t.Errorf("delta in sequence asked for a snapshot")
+	}
+	reported := master.hallOrdersMap[peer.localID]
+	if len(reported) != 2 || findOrder(reported, mcCall.Floor, mcCall.Button) < 0 || findOrder(reported, 3, mcCall.Button) < 0 {
+		t.Errorf("master has the peer's orders as %+v", reported)
+	}
+}
+
+func TestMissedSeqAsksForSnapshot(t *testing.T) {
+	master, peer := handoffPair()
+	out := make(chan structs.ElevatorDataWithID, 1)
+	peer.publish(peer.localData(), mcEpoch, out)
+	master.handleIncoming(<-out, mcEpoch)
+
+	// The first delta is lost on the way
+	pressAndPublish(peer, 2, mcEpoch.Add(time.Millisecond))
+	delta := pressAndPublish(peer, 3, mcEpoch.Add(2*time.Millisecond))
+	if !master.handleIncoming(delta, mcEpoch) {
+		t.Fatalf("gap in Seq did not ask for a snapshot")
+	}
+
+	// Only the elevator the request is for answers it
+	other := mcNewNode(2)
+	for _, m := range []*orderManager{peer, other} {
+		if m.handleIncoming(snapshotRequest(master.localID, peer.localID), mcEpoch) {
+			t.Errorf("%s asked for a snapshot in return", m.localID)
+		}
+	}
+	if !peer.snapshotWanted || other.snapshotWanted {
+		t.Fatalf("snapshot wanted on peer %v, other %v", peer.snapshotWanted, other.snapshotWanted)
+	}
+	now := mcEpoch.Add(3 * time.Millisecond)
+	peer.publishChanges(now, out)
+	snapshot := <-out
+	if snapshot.Kind != structs.Snapshot || peer.snapshotWanted {
+		t.Fatalf("answered with %v, snapshot still wanted: %v", snapshot.Kind, peer.snapshotWanted)
+	}
+	master.handleIncoming(snapshot, now)
+	if reported := master.hallOrdersMap[peer.localID]; findOrder(reported, 2, mcCall.Button) < 0 {
+		t.Errorf("snapshot did not bring the lost order: %+v", reported)
+	}
+}
+
+func TestDroppedSendKeepsSeq(t *testing.T) {
+	_, peer := handoffPair()
+	out := make(chan structs.ElevatorDataWithID, 1)
+	peer.publish(peer.localData(), mcEpoch, out)
+	sent := <-out
+
+	// The channel is full, so the press is not sent and does not use up a Seq
+	out <- structs.ElevatorDataWithID{}
+	now := mcEpoch.Add(time.Millisecond)
+	peer.handleLocalOrder(structs.HallOrder{Floor: 3, Dir: mcCall.Button}, now)
+	peer.publishChanges(now, out)
+	if peer.seq != sent.Seq || !peer.unsent() {
+		t.Fatalf("dropped send moved Seq to %d, want %d", peer.seq, sent.Seq)
+	}
+
+	<-out
+	peer.publishChanges(now, out)
+	msg := <-out
+	if msg.Seq != sent.Seq+1 || findOrder(msg.HallOrders, 3, mcCall.Button) < 0 {
+		t.Errorf("next message is %+v, want Seq %d with the press", msg, sent.Seq+1)
+	}
+}
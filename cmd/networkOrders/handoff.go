@@ -0,0 +1,145 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"fmt"
+	"sanntids/cmd/config"
+	"sanntids/cmd/eta"
+	"sanntids/cmd/structs"
+	"time"
+)
+
+// An assignment is handed off when the elevator it is assigned to
+// acknowledges it by setting AckedBy on its own copy of the order. Until
+// then the master resends the order with growing intervals. An elevator that
+// does not acknowledge an order in time, or does not serve it by its
+// deadline, is flagged and left out of assignment for a while, so its orders
+// go to other elevators.
+
+type orderKey struct {
+	floor int
+	dir   elevio.ButtonType
+}
+
+// handoff is the master's record of an assignment and whether it has been acknowledged.
+type handoff struct {
+	delegate string
+	presses  structs.PressVector
+	since    time.Time
+	deadline time.Time
+	retries  int
+	acked    bool
+}
+
+// elevatorFlag is why the master leaves an elevator out of assignment.
+// Flags for missing acknowledgements are lifted by the next one.
+type elevatorFlag struct {
+	since        time.Time
+	reason       string
+	clearedByAck bool
+}
+
+// trackHandoffs updates the master's records from the orders it is about to
+// broadcast, resending and giving up on assignments as needed.
+func (m *orderManager) trackHandoffs(view structs.ElevatorDataWithID, now time.Time) {
+	handoffs := make(map[orderKey]handoff)
+	for _, order := range view.HallOrders {
+		if order.Status != structs.Assigned {
+			continue
+		}
+		key := orderKey{order.Floor, order.Dir}
+		h, ok := m.handoffs[key]
+		if !ok || h.delegate != order.DelegatedID || !h.presses.Equal(order.Presses) {
+			h = handoff{
+				delegate: order.DelegatedID,
+				presses:  order.Presses,
+				since:    now,
+				deadline: now.Add(estimatedServiceTime(view, order) + config.CompletionSlackMs*time.Millisecond),
+				acked:    order.DelegatedID == m.localID,
+			}
+		}
+		if !h.acked {
+			waited := now.Sub(h.since)
+			switch {
+			case waited > config.AckDeadlineMs*time.Millisecond:
+				m.flag(h.delegate, now, true, "did not acknowledge floor %d %s within %d ms",
+					order.Floor, dirName(order.Dir), config.AckDeadlineMs)
+			case waited > time.Duration(h.retries+1)*config.AckRetryMs*time.Millisecond:
+				h.retries++
+				m.forgetSent(key)
+			}
+		}
+		if now.After(h.deadline) {
+			m.flag(h.delegate, now, false, "did not serve floor %d %s by %s",
+				order.Floor, dirName(order.Dir), h.deadline.Format("15:04:05"))
+		}
+		handoffs[key] = h
+	}
+	m.handoffs = handoffs
+
+	for id, f := range m.flagged {
+		if now.Sub(f.since) > config.FlaggedMs*time.Millisecond {
+			delete(m.flagged, id)
+		}
+	}
+}
+
+// flag leaves the elevator out of assignment, unless it already is.
+func (m *orderManager) flag(id string, now time.Time, clearedByAck bool, format string, args ...interface{}) {
+	if _, flagged := m.flagged[id]; flagged {
+		return
+	}
+	reason := fmt.Sprintf(format, args...)
+	m.logf("Flagged %s, it %s, reassigning its orders\n", id, reason)
+	m.flagged[id] = elevatorFlag{since: now, reason: reason, clearedByAck: clearedByAck}
+}
+
+// estimatedServiceTime is how long the elevator an order is assigned to is
+// expected to take to serve it, along with everything else assigned to it.
+// If the estimate fails, the time to travel the whole shaft is used.
+func estimatedServiceTime(view structs.ElevatorDataWithID, order structs.HallOrder) time.Duration {
+	hallRequests := hallRequestsOf(view.HallOrders, order.DelegatedID)
+	if state, ok := view.ElevatorState[order.DelegatedID]; ok {
+		if t := eta.ServiceTimes(state, hallRequests)[order.Floor][order.Dir]; t != eta.NotServed {
+			return t
+		}
+	}
+	return time.Duration(config.N_FLOORS) * time.Duration((config.TravelDuration_s+config.DoorOpenDuration_s)*float64(time.Second))
+}
+
+// ackHandoff records that senderID has acknowledged the order it reported.
+func (m *orderManager) ackHandoff(senderID string, order structs.HallOrder) {
+	key := orderKey{order.Floor, order.Dir}
+	h, ok := m.handoffs[key]
+	if !ok || h.delegate != senderID || !h.presses.Equal(order.Presses) {
+		return
+	}
+	h.acked = true
+	m.handoffs[key] = h
+	if f, flagged := m.flagged[senderID]; flagged && f.clearedByAck {
+		delete(m.flagged, senderID)
+	}
+}
+
+// acknowledgeAll marks the orders assigned to the local elevator as
+// acknowledged and clears the mark from all others.
+func (m *orderManager) acknowledgeAll() {
+	for i, order := range m.hallOrders {
+		if order.Status == structs.Assigned && order.DelegatedID == m.localID {
+			m.hallOrders[i].AckedBy = m.localID
+		} else {
+			m.hallOrders[i].AckedBy = ""
+		}
+	}
+}
+
+// forgetSent makes the next Delta carry the order again, as if it had never been sent.
+func (m *orderManager) forgetSent(key orderKey) {
+	orders := make([]structs.HallOrder, 0, len(m.lastSent.HallOrders))
+	for _, order := range m.lastSent.HallOrders {
+		if order.Floor != key.floor || order.Dir != key.dir {
+			orders = append(orders, order)
+		}
+	}
+	m.lastSent.HallOrders = orders
+}
@@ -0,0 +1,122 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/clock"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+// handoffPair returns a master and a peer that both know of a confirmed
+// order for mcCall, which mcAssign gives to the peer.
+func handoffPair() (*orderManager, *orderManager) {
+	master, peer := mcNewNode(0), mcNewNode(1)
+	for _, m := range []*orderManager{master, peer} {
+		m.ipMap[master.localID] = mcEpoch
+		m.ipMap[peer.localID] = mcEpoch
+		m.elevatorStates[peer.localID] = peer.elevatorStates[peer.localID]
+		m.elevatorStates[master.localID] = master.elevatorStates[master.localID]
+		m.hallOrders = []structs.HallOrder{{
+			Status:      structs.Confirmed,
+			DelegatedID: "undelegated",
+			Floor:       mcCall.Floor,
+			Dir:         mcCall.Button,
+			Presses:     structs.PressVector{peer.localID: 1},
+		}}
+		m.updateView()
+	}
+	return master, peer
+}
+
+// tickAt ticks the master at the given time, keeping the peer alive.
+func tickAt(master *orderManager, peer *orderManager, now time.Time) structs.ElevatorDataWithID {
+	master.ipMap[master.localID] = now
+	master.ipMap[peer.localID] = now
+	data := master.tick(now)
+	out := make(chan structs.ElevatorDataWithID, 1)
+	master.publish(data, now, out)
+	return data
+}
+
+func TestAcknowledgedHandoff(t *testing.T) {
+	master, peer := handoffPair()
+	data := tickAt(master, peer, mcEpoch)
+	if got := data.HallOrders[0].DelegatedID; got != peer.localID {
+		t.Fatalf("order assigned to %s, want %s", got, peer.localID)
+	}
+	if h := master.handoffs[orderKey{mcCall.Floor, mcCall.Button}]; h.acked {
+		t.Fatalf("handoff acked before the peer heard of it")
+	}
+
+	peer.handleIncoming(data, mcEpoch)
+	if got := peer.hallOrders[0].AckedBy; got != peer.localID {
+		t.Fatalf("peer did not acknowledge its order, AckedBy is %q", got)
+	}
+	master.handleIncoming(tableOf(peer), mcEpoch)
+	if h := master.handoffs[orderKey{mcCall.Floor, mcCall.Button}]; !h.acked {
+		t.Errorf("master did not record the acknowledgement")
+	}
+
+	later := mcEpoch.Add(2 * config.AckDeadlineMs * time.Millisecond)
+	if data := tickAt(master, peer, later); data.HallOrders[0].DelegatedID != peer.localID {
+		t.Errorf("acknowledged order was taken from the peer")
+	}
+}
+
+func TestUnacknowledgedHandoffIsRetriedThenReassigned(t *testing.T) {
+	master, peer := handoffPair()
+	clk := clock.NewFake(mcEpoch)
+	tickAt(master, peer, clk.Now())
+
+	// After the first retry interval the order goes out again even though it has not changed
+	clk.Advance((config.AckRetryMs + 10) * time.Millisecond)
+	now := clk.Now()
+	data := tickAt(master, peer, now)
+	if h := master.handoffs[orderKey{mcCall.Floor, mcCall.Button}]; h.retries != 1 {
+		t.Errorf("got %d retries, want 1", h.retries)
+	}
+	master.lastSnapshot = now
+	master.forgetSent(orderKey{mcCall.Floor, mcCall.Button})
+	if msg, ok := master.nextMessage(data, now); !ok || len(msg.HallOrders) != 1 {
+		t.Errorf("retry does not resend the order: %+v", msg)
+	}
+
+	clk.Advance((config.AckDeadlineMs - config.AckRetryMs) * time.Millisecond)
+	tickAt(master, peer, clk.Now())
+	if _, flagged := master.flagged[peer.localID]; !flagged {
+		t.Fatalf("peer not flagged after the ack deadline")
+	}
+	clk.Advance(config.TransmitTickerMs * time.Millisecond)
+	data = tickAt(master, peer, clk.Now())
+	if got := data.HallOrders[0].DelegatedID; got != master.localID {
+		t.Errorf("order still assigned to %s after the deadline", got)
+	}
+}
+
+func TestOverdueOrderIsReassigned(t *testing.T) {
+	master, peer := handoffPair()
+	data := tickAt(master, peer, mcEpoch)
+	peer.handleIncoming(data, mcEpoch)
+	master.handleIncoming(tableOf(peer), mcEpoch)
+
+	h := master.handoffs[orderKey{mcCall.Floor, mcCall.Button}]
+	if !h.deadline.After(mcEpoch.Add(config.CompletionSlackMs * time.Millisecond)) {
+		t.Fatalf("deadline %v leaves no time to serve the order", h.deadline)
+	}
+
+	now := h.deadline.Add(time.Millisecond)
+	tickAt(master, peer, now)
+	f, flagged := master.flagged[peer.localID]
+	if !flagged || f.clearedByAck {
+		t.Fatalf("peer not flagged for an overdue order: %+v", master.flagged)
+	}
+	master.handleIncoming(tableOf(peer), now)
+	if _, flagged := master.flagged[peer.localID]; !flagged {
+		t.Errorf("acknowledging an order lifted the flag for not serving one")
+	}
+	data = tickAt(master, peer, now.Add(config.TransmitTickerMs*time.Millisecond))
+	if got := data.HallOrders[0].DelegatedID; got != master.localID {
+		t.Errorf("overdue order still assigned to %s", got)
+	}
+}
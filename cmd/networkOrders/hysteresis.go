@@ -0,0 +1,67 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/config"
+	"sanntids/cmd/eta"
+	"sanntids/cmd/structs"
+	"time"
+)
+
+// The assigner starts from scratch every tick, so an elevator passing a
+// floor can be enough to move an order back and forth between elevators.
+// keepAssignments makes assignments sticky instead.
+
+// keepAssignments gives orders the assigner moved back to the elevator they
+// were assigned to, unless that elevator can no longer take orders or the
+// new one is estimated to serve the order at least margin sooner.
+func keepAssignments(previous []structs.HallOrder, assigned []structs.HallOrder, states map[string]structs.HRAElevState, margin time.Duration) {
+	for i, order := range assigned {
+		j := findOrder(previous, order.Floor, order.Dir)
+		if j < 0 || previous[j].Status != structs.Assigned || previous[j].DelegatedID == order.DelegatedID {
+			continue
+		}
+		oldID, newID := previous[j].DelegatedID, order.DelegatedID
+		oldState, canTake := states[oldID]
+		newState, known := states[newID]
+		if !canTake || !known {
+			continue
+		}
+
+		withNew := hallRequestsOf(assigned, newID)
+		withOld := hallRequestsOf(assigned, oldID)
+		withOld[order.Floor][order.Dir] = true
+		newTime := eta.ServiceTimes(newState, withNew)[order.Floor][order.Dir]
+		oldTime := eta.ServiceTimes(oldState, withOld)[order.Floor][order.Dir]
+		if newTime == eta.NotServed || oldTime == eta.NotServed || oldTime-newTime < margin {
+			assigned[i].DelegatedID = oldID
+		}
+	}
+}
+
+// adoptAssignments is run by the master to take its own assignments into its
+// order table, counting the orders that moved between elevators.
+func (m *orderManager) adoptAssignments(view structs.ElevatorDataWithID) {
+	for _, order := range view.HallOrders {
+		if order.Status != structs.Assigned {
+			continue
+		}
+		i := findOrder(m.hallOrders, order.Floor, order.Dir)
+		if i >= 0 && m.hallOrders[i].Status == structs.Assigned &&
+			m.hallOrders[i].DelegatedID != order.DelegatedID && m.hallOrders[i].Presses.Equal(order.Presses) {
+			m.reassignments++
+		}
+		m.mergeOrder(m.localID, m.view, order)
+	}
+	m.acknowledgeAll()
+}
+
+// hallRequestsOf returns the hall requests assigned to id.
+func hallRequestsOf(orders []structs.HallOrder, id string) [config.N_FLOORS][2]bool {
+	var hallRequests [config.N_FLOORS][2]bool
+	for _, o := range orders {
+		if o.Status == structs.Assigned && o.DelegatedID == id {
+			hallRequests[o.Floor][o.Dir] = true
+		}
+	}
+	return hallRequests
+}
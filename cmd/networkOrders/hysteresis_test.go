@@ -0,0 +1,51 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestKeepAssignments(t *testing.T) {
+	margin := config.ReassignMarginMs * time.Millisecond
+	tests := []struct {
+		name   string
+		floor  int
+		states map[string]structs.HRAElevState
+		want   string
+	}{
+		{"small gain keeps the order", 1, map[string]structs.HRAElevState{"a": structs.IdleAt(0), "b": structs.IdleAt(2)}, "b"},
+		{"large gain moves the order", 0, map[string]structs.HRAElevState{"a": structs.IdleAt(0), "b": structs.IdleAt(3)}, "a"},
+		{"old elevator unavailable", 1, map[string]structs.HRAElevState{"a": structs.IdleAt(0)}, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := []structs.HallOrder{{Floor: tt.floor, Dir: elevio.BT_HallUp, Status: structs.Assigned, DelegatedID: "b"}}
+			assigned := []structs.HallOrder{{Floor: tt.floor, Dir: elevio.BT_HallUp, Status: structs.Assigned, DelegatedID: "a"}}
+			keepAssignments(previous, assigned, tt.states, margin)
+			if got := assigned[0].DelegatedID; got != tt.want {
+				t.Errorf("order assigned to %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdoptAssignmentsCountsReassignments(t *testing.T) {
+	m := mcNewNode(0)
+	order := structs.HallOrder{Floor: 1, Dir: elevio.BT_HallUp, Status: structs.Assigned, DelegatedID: "10.0.0.2", Presses: structs.PressVector{"10.0.0.2": 1}}
+	m.hallOrders = []structs.HallOrder{order}
+
+	order.DelegatedID = m.localID
+	view := structs.ElevatorDataWithID{HallOrders: []structs.HallOrder{order}}
+	m.adoptAssignments(view)
+	m.adoptAssignments(view)
+
+	if m.hallOrders[0].DelegatedID != m.localID {
+		t.Errorf("master did not adopt its assignment: %+v", m.hallOrders[0])
+	}
+	if m.reassignments != 1 {
+		t.Errorf("counted %d reassignments, want 1", m.reassignments)
+	}
+}
@@ -0,0 +1,521 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"flag"
+	"fmt"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// This file is a bounded model checker for the hall order protocol. It drives
+// orderManager instances directly and explores every interleaving of button
+// presses, cancellations, ticks, message delivery, duplication and loss,
+// timeouts and node restarts up to a fixed depth. From every reachable state
+// it then lets the network heal and checks that every press that was not
+// cancelled is served and every lamp goes dark.
+
+var mcDeep = flag.Bool("deep", false, "explore the order protocol model to a larger depth")
+
+var mcEpoch = time.Unix(0, 0)
+
+var mcCall = elevio.ButtonEvent{Floor: 1, Button: elevio.BT_HallUp}
+
+type mcMessage struct {
+	from int
+	data structs.ElevatorDataWithID
+}
+
+type mcWorld struct {
+	nodes    []*orderManager
+	lamps    [][config.N_FLOORS][2]bool
+	inFlight []mcMessage
+	presses  int
+	restarts int
+	cancels  int
+	// unserved holds the presses no elevator has stopped for yet, and no one has cancelled
+	unserved structs.PressVector
+}
+
+type mcLimits struct {
+	nodes       int
+	depth       int
+	presses     int
+	restarts    int
+	cancels     int
+	keepPerNode int
+}
+
+func mcNodeID(i int) string {
+	return fmt.Sprintf("10.0.0.%d", i+1)
+}
+
+// mcAssign stands in for the hall request assigner: it is deterministic and
+// spreads calls over the elevators so that not only the master serves them.
+func mcAssign(data structs.ElevatorDataWithID) structs.ElevatorDataWithID {
+	ids := make([]string, 0, len(data.ElevatorState))
+	for id := range data.ElevatorState {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := structs.ElevatorDataWithID{ElevatorID: data.ElevatorID, ElevatorState: data.ElevatorState}
+	if len(ids) == 0 {
+		return result
+	}
+	// Like the real assigner only floor and direction survive the round trip
+	for _, order := range data.HallOrders {
+		result.HallOrders = append(result.HallOrders, structs.HallOrder{
+			Floor:       order.Floor,
+			Dir:         order.Dir,
+			Status:      structs.Assigned,
+			DelegatedID: ids[(order.Floor+int(order.Dir))%len(ids)],
+		})
+	}
+	return result
+}
+
+func mcNewNode(i int) *orderManager {
+	m := newOrderManager(mcNodeID(i))
+	m.assign = mcAssign
+	m.logf = func(string, ...interface{}) {}
+	m.elevatorStates[m.localID] = structs.IdleAt(0)
+	return m
+}
+
+func mcNewWorld(n int) *mcWorld {
+	w := &mcWorld{lamps: make([][config.N_FLOORS][2]bool, n), unserved: structs.PressVector{}}
+	for i := 0; i < n; i++ {
+		w.nodes = append(w.nodes, mcNewNode(i))
+	}
+	return w
+}
+
+func cloneOrders(orders []structs.HallOrder) []structs.HallOrder {
+	if orders == nil {
+		return nil
+	}
+	c := make([]structs.HallOrder, len(orders))
+	copy(c, orders)
+	return c
+}
+
+func cloneManager(m *orderManager) *orderManager {
+	c := *m
+	c.elevatorStates = make(map[string]structs.HRAElevState)
+	for id, state := range m.elevatorStates {
+		c.elevatorStates[id] = state
+	}
+	c.hallOrders = cloneOrders(m.hallOrders)
+	c.hallOrdersMap = make(map[string][]structs.HallOrder)
+	for id, orders := range m.hallOrdersMap {
+		c.hallOrdersMap[id] = cloneOrders(orders)
+	}
+	c.ipMap = make(map[string]time.Time)
+	for id, t := range m.ipMap {
+		c.ipMap[id] = t
+	}
+	c.peerSeq = make(map[string]uint64)
+	for id, seq := range m.peerSeq {
+		c.peerSeq[id] = seq
+	}
+	c.handoffs = make(map[orderKey]handoff)
+	for key, h := range m.handoffs {
+		c.handoffs[key] = h
+	}
+	c.flagged = make(map[string]elevatorFlag)
+	for id, f := range m.flagged {
+		c.flagged[id] = f
+	}
+	c.traffic.calls = append([]hallCall(nil), m.traffic.calls...)
+	c.audit.last = make(map[orderKey]structs.HallOrder)
+	for key, order := range m.audit.last {
+		c.audit.last[key] = order
+	}
+	c.audit.calls = make(map[orderKey]uint64)
+	for key, call := range m.audit.calls {
+		c.audit.calls[key] = call
+	}
+	c.audit.log.events = append([]AuditEvent(nil), m.audit.log.events...)
+	c.audit.recent = append([]AuditEvent(nil), m.audit.recent...)
+	c.dest.calls = cloneDestinations(m.dest.calls)
+	c.dest.replies = append([]destinationReply(nil), m.dest.replies...)
+	c.dest.done = make(map[string]time.Time)
+	for id, t := range m.dest.done {
+		c.dest.done[id] = t
+	}
+	if m.parking != nil {
+		c.parking = make(map[string]int)
+		for id, floor := range m.parking {
+			c.parking[id] = floor
+		}
+	}
+	return &c
+}
+
+func (w *mcWorld) clone() *mcWorld {
+	c := *w
+	c.nodes = make([]*orderManager, len(w.nodes))
+	for i, m := range w.nodes {
+		c.nodes[i] = cloneManager(m)
+	}
+	c.lamps = append([][config.N_FLOORS][2]bool(nil), w.lamps...)
+	c.inFlight = append([]mcMessage(nil), w.inFlight...)
+	return &c
+}
+
+func ordersKey(orders []structs.HallOrder) string {
+	parts := make([]string, 0, len(orders))
+	for _, o := range orders {
+		parts = append(parts, fmt.Sprintf("%d/%d%v:%v@%s", o.Floor, o.Dir, o.Presses, o.Status, o.DelegatedID))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func managerKey(m *orderManager) string {
+	var b strings.Builder
+	ids := make([]string, 0, len(m.ipMap))
+	for id := range m.ipMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	fmt.Fprintf(&b, "seen%v view %s states[", ids, m.view)
+	for _, id := range sortedKeys(m.elevatorStates) {
+		b.WriteString(id + " ")
+	}
+	fmt.Fprintf(&b, "] orders[%s] views[", ordersKey(m.hallOrders))
+	for _, id := range sortedKeys(m.hallOrdersMap) {
+		fmt.Fprintf(&b, "%s=(%s)", id, ordersKey(m.hallOrdersMap[id]))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]structs.HRAElevState:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string][]structs.HallOrder:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (w *mcWorld) key() string {
+	var b strings.Builder
+	for i, m := range w.nodes {
+		fmt.Fprintf(&b, "n%d{%s lamps%v}", i, managerKey(m), w.lamps[i])
+	}
+	for _, msg := range w.inFlight {
+		fmt.Fprintf(&b, "m%d(%s %s)", msg.from, msg.data.View, ordersKey(msg.data.HallOrders))
+	}
+	fmt.Fprintf(&b, "p%d r%d c%d unserved=%v", w.presses, w.restarts, w.cancels, w.unserved)
+	return b.String()
+}
+
+func (w *mcWorld) press(i int) {
+	w.presses++
+	m := w.nodes[i]
+	m.handleLocalOrder(structs.HallOrder{
+		Status:      structs.New,
+		DelegatedID: "undelegated",
+		Floor:       mcCall.Floor,
+		Dir:         mcCall.Button,
+	}, mcEpoch.Add(time.Duration(w.presses)*time.Millisecond))
+	order := m.hallOrders[findOrder(m.hallOrders, mcCall.Floor, mcCall.Button)]
+	w.unserved = w.unserved.Merge(structs.PressVector{m.localID: order.Presses[m.localID]})
+}
+
+// cancel takes the call back on node i. The presses it covers no longer need serving.
+func (w *mcWorld) cancel(i int) {
+	w.cancels++
+	m := w.nodes[i]
+	m.handleLocalOrder(structs.HallOrder{Status: structs.Cancelled, Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch)
+	if j := findOrder(m.hallOrders, mcCall.Floor, mcCall.Button); j >= 0 && m.hallOrders[j].Status == structs.Cancelled {
+		for id, stamp := range w.unserved {
+			if m.hallOrders[j].Presses.Covers(structs.PressVector{id: stamp}) {
+				w.unserved = copyWithout(w.unserved, id)
+			}
+		}
+	}
+}
+
+// forgetPressesNotCoveredBy drops the unserved presses that none of the orders cover.
+func (w *mcWorld) forgetPressesNotCoveredBy(orders []structs.HallOrder) {
+	for id, stamp := range w.unserved {
+		known := false
+		for _, order := range orders {
+			if order.Presses.Covers(structs.PressVector{id: stamp}) {
+				known = true
+			}
+		}
+		if !known {
+			w.unserved = copyWithout(w.unserved, id)
+		}
+	}
+}
+
+func copyWithout(v structs.PressVector, id string) structs.PressVector {
+	c := v.Merge(nil)
+	delete(c, id)
+	return c
+}
+
+func (w *mcWorld) tick(i int, keep int) structs.ElevatorDataWithID {
+	data := w.nodes[i].tick(mcEpoch)
+	w.lamps[i] = hallLights(data)
+
+	// Only the newest messages of each sender are kept around for late or duplicate delivery
+	var kept []mcMessage
+	count := 0
+	for j := len(w.inFlight) - 1; j >= 0; j-- {
+		if w.inFlight[j].from == i {
+			count++
+			if count >= keep {
+				continue
+			}
+		}
+		kept = append([]mcMessage{w.inFlight[j]}, kept...)
+	}
+	w.inFlight = append(kept, mcMessage{from: i, data: data})
+	return data
+}
+
+func (w *mcWorld) deliver(msg mcMessage, to int) {
+	w.nodes[to].handleIncoming(cloneData(msg.data), mcEpoch)
+}
+
+func cloneData(data structs.ElevatorDataWithID) structs.ElevatorDataWithID {
+	data.HallOrders = cloneOrders(data.HallOrders)
+	return data
+}
+
+// serve lets node i's elevator stop for the call if the node has it among its requests.
+func (w *mcWorld) serve(i int) bool {
+	m := w.nodes[i]
+	requests := getMyRequests(m.hallOrders, m.elevatorStates, m.localID)
+	if !requests[mcCall.Floor][mcCall.Button] {
+		return false
+	}
+	order := m.hallOrders[findOrder(m.hallOrders, mcCall.Floor, mcCall.Button)]
+	for id, stamp := range w.unserved {
+		if order.Presses.Covers(structs.PressVector{id: stamp}) {
+			w.unserved = copyWithout(w.unserved, id)
+		}
+	}
+	m.handleCompleted([]elevio.ButtonEvent{mcCall}, mcEpoch)
+	return true
+}
+
+// restart wipes node i. A press that no other node had heard of is gone with
+// the node, which the passenger sees as the lamp going dark; that is not
+// counted as a lost order.
+func (w *mcWorld) restart(i int) {
+	w.nodes[i] = mcNewNode(i)
+	w.lamps[i] = [config.N_FLOORS][2]bool{}
+	w.restarts++
+
+	var known []structs.HallOrder
+	for _, m := range w.nodes {
+		known = append(known, m.hallOrders...)
+	}
+	w.forgetPressesNotCoveredBy(known)
+}
+
+// successors returns every world reachable in one step, labelled for counterexamples.
+func (w *mcWorld) successors(lim mcLimits) ([]*mcWorld, []string) {
+	var next []*mcWorld
+	var labels []string
+	add := func(label string, step func(c *mcWorld)) {
+		c := w.clone()
+		step(c)
+		next = append(next, c)
+		labels = append(labels, label)
+	}
+
+	for i := range w.nodes {
+		i := i
+		if w.presses < lim.presses {
+			add(fmt.Sprintf("press(%d)", i), func(c *mcWorld) { c.press(i) })
+		}
+		add(fmt.Sprintf("tick(%d)", i), func(c *mcWorld) { c.tick(i, lim.keepPerNode) })
+		add(fmt.Sprintf("serve(%d)", i), func(c *mcWorld) { c.serve(i) })
+		if w.cancels < lim.cancels {
+			add(fmt.Sprintf("cancel(%d)", i), func(c *mcWorld) { c.cancel(i) })
+		}
+		if w.restarts < lim.restarts {
+			add(fmt.Sprintf("restart(%d)", i), func(c *mcWorld) { c.restart(i) })
+		}
+		for peer := range w.nodes[i].ipMap {
+			peer := peer
+			if peer != w.nodes[i].localID {
+				add(fmt.Sprintf("timeout(%d,%s)", i, peer), func(c *mcWorld) { c.nodes[i].removePeer(peer) })
+			}
+		}
+		for j, msg := range w.inFlight {
+			msg := msg
+			add(fmt.Sprintf("deliver(#%d from %d to %d)", j, msg.from, i), func(c *mcWorld) { c.deliver(msg, i) })
+		}
+	}
+	return next, labels
+}
+
+// heal runs the system with no faults: every node ticks, every message reaches
+// every node and elevators serve what they are assigned. It returns a
+// description of the problem if the call is not resolved within the bound.
+func (w *mcWorld) heal() string {
+	const rounds = 12
+	for r := 0; r < rounds; r++ {
+		var msgs []mcMessage
+		for i := range w.nodes {
+			msgs = append(msgs, mcMessage{from: i, data: w.tick(i, 1)})
+		}
+		for _, msg := range msgs {
+			for to := range w.nodes {
+				w.deliver(msg, to)
+			}
+		}
+		for i := range w.nodes {
+			w.serve(i)
+		}
+	}
+
+	if len(w.unserved) > 0 {
+		return fmt.Sprintf("order lost: no elevator stopped for presses %v", w.unserved)
+	}
+	for i, m := range w.nodes {
+		if w.lamps[i][mcCall.Floor][mcCall.Button] {
+			return fmt.Sprintf("lamp stays lit on node %d", i)
+		}
+		for _, order := range m.hallOrders {
+			if !ended(order.Status) {
+				return fmt.Sprintf("order never completes on node %d: %+v", i, order)
+			}
+		}
+	}
+	return ""
+}
+
+func (w *mcWorld) checkTransitions(prev *mcWorld) string {
+	for i, m := range w.nodes {
+		if i >= len(prev.nodes) || prev.nodes[i].localID != m.localID {
+			continue
+		}
+		before := prev.nodes[i].hallOrders
+		for _, order := range m.hallOrders {
+			from := structs.Unknown
+			if j := findOrder(before, order.Floor, order.Dir); j >= 0 && before[j].Presses.Equal(order.Presses) {
+				from = before[j].Status
+			}
+			if !from.CanTransitionTo(order.Status) {
+				return fmt.Sprintf("illegal transition %v -> %v on node %d", from, order.Status, i)
+			}
+		}
+	}
+	return ""
+}
+
+func runModelCheck(t *testing.T, lim mcLimits) {
+	type entry struct {
+		world *mcWorld
+		trace []string
+	}
+
+	start := mcNewWorld(lim.nodes)
+	visited := map[string]bool{start.key(): true}
+	frontier := []entry{{world: start}}
+
+	for depth := 0; depth <= lim.depth && len(frontier) > 0; depth++ {
+		var nextFrontier []entry
+		for _, e := range frontier {
+			if problem := e.world.clone().heal(); problem != "" {
+				t.Fatalf("%s\ntrace: %s", problem, strings.Join(e.trace, " "))
+			}
+			if depth == lim.depth {
+				continue
+			}
+
+			next, labels := e.world.successors(lim)
+			for k, c := range next {
+				trace := append(append([]string(nil), e.trace...), labels[k])
+				if problem := c.checkTransitions(e.world); problem != "" {
+					// A restarted node starts from scratch, which is not a transition
+					if !strings.HasPrefix(labels[k], "restart") {
+						t.Fatalf("%s\ntrace: %s", problem, strings.Join(trace, " "))
+					}
+				}
+				key := c.key()
+				if visited[key] {
+					continue
+				}
+				visited[key] = true
+				nextFrontier = append(nextFrontier, entry{world: c, trace: trace})
+			}
+		}
+		frontier = nextFrontier
+	}
+	t.Logf("%d nodes: explored %d states", lim.nodes, len(visited))
+}
+
+func TestOrderStatusTransitions(t *testing.T) {
+	legal := map[[2]structs.OrderStatus]bool{
+		{structs.New, structs.Confirmed}:       true,
+		{structs.New, structs.Assigned}:        true,
+		{structs.New, structs.Completed}:       true,
+		{structs.Confirmed, structs.Assigned}:  true,
+		{structs.Confirmed, structs.Completed}: true,
+		{structs.Assigned, structs.Completed}:  true,
+		{structs.Completed, structs.New}:       true,
+		{structs.Unknown, structs.New}:         true,
+		{structs.Unknown, structs.Confirmed}:   true,
+		{structs.Unknown, structs.Assigned}:    true,
+		{structs.Unknown, structs.Completed}:   true,
+		{structs.New, structs.Cancelled}:       true,
+		{structs.Confirmed, structs.Cancelled}: true,
+		{structs.Assigned, structs.Cancelled}:  true,
+		{structs.Cancelled, structs.New}:       true,
+		{structs.Unknown, structs.Cancelled}:   true,
+	}
+	statuses := []structs.OrderStatus{structs.Unknown, structs.New, structs.Confirmed, structs.Assigned, structs.Completed, structs.Cancelled}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := from == to || legal[[2]structs.OrderStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%v -> %v: got %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+// mcDepth picks the depth for the model checks: cheap by default, and with
+// -deep a larger one, kept smaller under -short.
+func mcDepth(cheap int, deepShort int, deep int) int {
+	switch {
+	case !*mcDeep:
+		return cheap
+	case testing.Short():
+		return deepShort
+	}
+	return deep
+}
+
+func TestModelCheckTwoNodes(t *testing.T) {
+	depth := mcDepth(5, 7, 9)
+	runModelCheck(t, mcLimits{nodes: 2, depth: depth, presses: 2, restarts: 1, cancels: 1, keepPerNode: 2})
+}
+
+func TestModelCheckThreeNodes(t *testing.T) {
+	depth := mcDepth(4, 6, 7)
+	runModelCheck(t, mcLimits{nodes: 3, depth: depth, presses: 1, restarts: 1, keepPerNode: 1})
+}
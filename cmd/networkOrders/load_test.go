@@ -0,0 +1,32 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+)
+
+func TestFullElevatorGetsNoCalls(t *testing.T) {
+	full := structs.IdleAt(0)
+	full.LoadKg = config.FullLoadKg
+	data := structs.ElevatorDataWithID{
+		ElevatorState: map[string]structs.HRAElevState{"a": full, "b": structs.IdleAt(3)},
+		HallOrders: []structs.HallOrder{
+			{Floor: 0, Dir: elevio.BT_HallUp, Status: structs.Confirmed},
+			{Floor: 1, Dir: elevio.BT_HallUp, Status: structs.Confirmed},
+		},
+	}
+	for _, order := range assignOrders(data, mcAssign, nil, false).HallOrders {
+		if order.DelegatedID != "b" {
+			t.Errorf("call at floor %d given to the full elevator", order.Floor)
+		}
+	}
+
+	// If every elevator is full the calls are still served
+	data.ElevatorState["b"] = full
+	assigned := assignOrders(data, mcAssign, nil, false).HallOrders
+	if len(assigned) != 2 || assigned[0].Status != structs.Assigned {
+		t.Errorf("calls not assigned when all elevators are full: %+v", assigned)
+	}
+}
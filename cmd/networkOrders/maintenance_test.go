@@ -0,0 +1,29 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/config"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceHandsOrdersOver(t *testing.T) {
+	master, peer := handoffPair()
+	data := tickAt(master, peer, mcEpoch)
+	peer.handleIncoming(data, mcEpoch)
+	if !getMyRequests(peer.hallOrders, peer.elevatorStates, peer.localID)[mcCall.Floor][mcCall.Button] {
+		t.Fatalf("peer was not given the order")
+	}
+
+	state := peer.elevatorStates[peer.localID]
+	state.Maintenance = true
+	peer.elevatorStates[peer.localID] = state
+	if getMyRequests(peer.hallOrders, peer.elevatorStates, peer.localID)[mcCall.Floor][mcCall.Button] {
+		t.Errorf("peer in maintenance still serves a hall order")
+	}
+
+	master.handleIncoming(tableOf(peer), mcEpoch)
+	data = tickAt(master, peer, mcEpoch.Add(config.TransmitTickerMs*time.Millisecond))
+	if got := data.HallOrders[0].DelegatedID; got != master.localID {
+		t.Errorf("order still assigned to %s in maintenance", got)
+	}
+}
@@ -2,6 +2,8 @@ package networkOrders
 
 import (
 	"Driver-go/elevio"
+	"fmt"
+	"sanntids/cmd/clock"
 	"sanntids/cmd/config"
 	"sanntids/cmd/structs"
 	"sanntids/cmd/runHRA"
@@ -9,222 +11,689 @@ import (
 	"time"
 )
 
+// orderManager is the state owned by NetworkOrderManager. It is kept apart
+// from the channel loop so the order protocol can be driven step by step,
+// as the model checker in the tests does.
+type orderManager struct {
+	localID        string
+	elevatorStates map[string]structs.HRAElevState
+	hallOrders     []structs.HallOrder
+	hallOrdersMap  map[string][]structs.HallOrder
+	ipMap          map[string]time.Time
+	assign         func(structs.ElevatorDataWithID) structs.ElevatorDataWithID
+	view           structs.ViewID
+	isolated       bool
+	reassignments  uint64
+	arrivals       arrivals
+	handoffs       map[orderKey]handoff
+	flagged        map[string]elevatorFlag
+	parkingMode    ParkingStrategy
+	parking        map[string]int
+	traffic        trafficStats
+	trafficSource  TrafficSource
+	trafficMode    TrafficMode
+	recall         structs.Recall
+	dest           destinations
+	audit          auditTrail
+	logf           func(format string, args ...interface{})
+
+	// Dissemination: what was last broadcast, and the last Seq seen from each peer
+	seq            uint64
+	lastSent       structs.ElevatorDataWithID
+	lastSnapshot   time.Time
+	snapshotWanted bool
+	peerSeq        map[string]uint64
+}
+
+func newOrderManager(localID string) *orderManager {
+	return &orderManager{
+		localID:        localID,
+		view:           viewOf(localID, nil),
+		logf:           printLog,
+		elevatorStates: make(map[string]structs.HRAElevState),
+		hallOrders:     make([]structs.HallOrder, 0),
+		hallOrdersMap:  make(map[string][]structs.HallOrder, 0),
+		ipMap:          make(map[string]time.Time, 0),
+		assign:         runHRA.RunHRA,
+		peerSeq:        make(map[string]uint64),
+		handoffs:       make(map[orderKey]handoff),
+		flagged:        make(map[string]elevatorFlag),
+		dest:           destinations{done: make(map[string]time.Time)},
+		audit:          auditTrail{last: make(map[orderKey]structs.HallOrder), calls: make(map[orderKey]uint64)},
+	}
+}
+
+func printLog(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
 // NetworkOrderManager handles the conversion of local orders to network-ready format
 // and manages incoming orders from other elevators
 func NetworkOrderManager(
+	clk clock.Clock,
 	localElevatorID string,
 	localElevStateChan <-chan structs.HRAElevState,
 	localOrdersChan <-chan structs.HallOrder,
 	completedRequetsChan <-chan []elevio.ButtonEvent,
 	incomingDataChan <-chan structs.ElevatorDataWithID,
 	outgoingDataChan chan<- structs.ElevatorDataWithID,
-    requestsToLocalChan chan<- [config.N_FLOORS][config.N_BUTTONS]bool,
+	ordersToLocalChan chan<- structs.LocalOrders,
+	parking ParkingStrategy,
+	traffic TrafficSource,
+	recallChan <-chan bool,
+	destinationChan <-chan DestinationRequest,
 ) {
-	elevatorStates := make(map[string]structs.HRAElevState)
-	hallOrders := make([]structs.HallOrder, 0)
-	hallOrdersMap := make(map[string][]structs.HallOrder, 0)
-	ipMap := make(map[string]time.Time, 0)
+	m := newOrderManager(localElevatorID)
+	m.parkingMode = parking
+	m.trafficSource = traffic
 
-	transmitTicker := time.NewTicker(config.TransmitTickerMs * time.Millisecond)
+	transmitTicker := clk.NewTicker(config.TransmitTickerMs * time.Millisecond)
 	defer transmitTicker.Stop()
 
 	for {
 		select {
-		case <-transmitTicker.C:
-			currentTime := time.Now()
-			for ip, lastSeen := range ipMap {
-
-				if currentTime.Sub(lastSeen) > config.ElevatorTimeoutMs*time.Millisecond {
-					delete(ipMap, ip)
-					delete(elevatorStates, ip)
-					delete(hallOrdersMap, ip)
-				}
-			}
-			if util.IsMaster(ipMap, localElevatorID) {
-				hallOrders = applyNewOrderBarrier(hallOrders, hallOrdersMap, ipMap)
-			}
-
-			sendNetworkData(localElevatorID, elevatorStates, hallOrders, outgoingDataChan, ipMap)
+		case <-transmitTicker.C():
+			networkData := m.tick(clk.Now())
+			setAllLights(networkData)
+			m.publishStatus(networkData)
+			m.publish(networkData, clk.Now(), outgoingDataChan)
 
 			//Get the requests assigned to localID and send them to Elevator
-			myRequests := getMyRequests(hallOrders, elevatorStates, localElevatorID)
-			requestsToLocalChan <- myRequests
-		case incomingData := <-incomingDataChan:
-
-			ipMap[incomingData.ElevatorID] = time.Now()
-			hallOrdersMap[incomingData.ElevatorID] = incomingData.HallOrders
-			for id, state := range incomingData.ElevatorState {
-				if incomingData.ElevatorID == id {
-					elevatorStates[id] = state
-				}
+			myRequests := getMyRequests(m.hallOrders, m.elevatorStates, m.localID)
+			m.destinationRequests(&myRequests)
+			ordersToLocalChan <- structs.LocalOrders{
+				Requests:   myRequests,
+				Priorities: getMyPriorities(m.hallOrders, m.localID),
+				ParkFloor:  m.parkFloor(),
+				Recall:     m.recall,
 			}
-			for _, newOrder := range incomingData.HallOrders {
-				if !isDuplicateOrder(hallOrders, newOrder) {
-					hallOrders = append(hallOrders, newOrder)
-					continue
-				}
-				
-				for i, order := range hallOrders {
-					if order.Floor != newOrder.Floor || order.Dir != newOrder.Dir {
-						continue
-					}
-					
-					if util.IsMaster(ipMap, incomingData.ElevatorID) {
-						if (order.Status == structs.New && newOrder.Status == structs.Completed) || 
-						(order.Status == structs.Completed && newOrder.Status == structs.Assigned) {
-							break
-						}
-						hallOrders[i].Status = newOrder.Status
-						hallOrders[i].DelegatedID = newOrder.DelegatedID
-					}
-					
-					// The master should only accept certain orders
-					if util.IsMaster(ipMap, localElevatorID) {
-						switch newOrder.Status {
-						case structs.New:
-							if order.Status == structs.Completed {
-								hallOrders[i].Status = newOrder.Status
-								hallOrders[i].DelegatedID = newOrder.DelegatedID
-							}
-						case structs.Assigned:
-						case structs.Confirmed:
-						case structs.Completed:
-							if order.Status != structs.New && order.DelegatedID == incomingData.ElevatorID {
-								hallOrders[i].Status = newOrder.Status
-								hallOrders[i].DelegatedID = newOrder.DelegatedID
-							}
-						}
-					}
-					break
+
+		case incomingData := <-incomingDataChan:
+			if m.handleIncoming(incomingData, clk.Now()) {
+				select {
+				case outgoingDataChan <- snapshotRequest(m.localID, incomingData.ElevatorID):
+				default:
 				}
 			}
+
 		case localState, ok := <-localElevStateChan:
 			if !ok {
 				return
 			}
-
-			elevatorStates[localElevatorID] = localState
+			m.elevatorStates[m.localID] = localState
 
 		case localOrder, ok := <-localOrdersChan:
 			if !ok {
 				return
 			}
+			m.handleLocalOrder(localOrder, clk.Now())
 
-			if !isDuplicateOrder(hallOrders, localOrder) {
-				hallOrders = append(hallOrders, localOrder)
-			} else {
-				for i := range hallOrders {
-					if hallOrders[i].Floor == localOrder.Floor && hallOrders[i].Dir == localOrder.Dir {
-						hallOrders[i].Status = localOrder.Status
-						hallOrders[i].DelegatedID = localOrder.DelegatedID
-						break
-					}
-				}
-			}
-		case completedReqs:= <-completedRequetsChan:
-			for _, req := range completedReqs {
-				hallOrders = updateOrderStatus(hallOrders, req.Floor, int(req.Button), structs.Completed)
-			}
+		case completedReqs := <-completedRequetsChan:
+			m.handleCompleted(completedReqs, clk.Now())
+
+		case active := <-recallChan:
+			m.setRecall(active, clk.Now())
+
+		case request := <-destinationChan:
+			m.requestDestination(request, clk.Now())
 		}
+
+		m.recordAudit(clk.Now())
+		m.answerDestinations(clk.Now())
+
+		m.publishChanges(clk.Now(), outgoingDataChan)
 	}
 }
 
-func isDuplicateOrder(orders []structs.HallOrder, newOrder structs.HallOrder) bool {
-	for _, order := range orders {
-		if order.Floor == newOrder.Floor && order.Dir == newOrder.Dir {
-			return true
+// publishChanges sends what has changed since the last message right away
+// instead of waiting for the next tick. The orders go out as they are, the
+// master assigns them on the tick.
+func (m *orderManager) publishChanges(now time.Time, outgoingDataChan chan<- structs.ElevatorDataWithID) {
+	if m.unsent() {
+		m.publish(m.localData(), now, outgoingDataChan)
+	}
+}
+
+// tick forgets elevators that have timed out, lets the master confirm new
+// orders, and returns the data to broadcast.
+func (m *orderManager) tick(now time.Time) structs.ElevatorDataWithID {
+	for ip, lastSeen := range m.ipMap {
+		if now.Sub(lastSeen) > config.ElevatorTimeoutMs*time.Millisecond {
+			m.removePeer(ip)
 		}
 	}
-	return false
+	m.updateView()
+	m.updateIsolation()
+	m.updateDestinations(now)
+	if m.recall.Active {
+		m.hallOrders = cancelAllOrders(m.hallOrders)
+		m.cancelAllDestinations()
+	} else if m.isolated {
+		m.hallOrders = takeAllOrders(m.hallOrders, m.localID)
+		takeAllDestinations(m.dest.calls, m.localID)
+		m.acknowledgeAll()
+	} else if util.IsMaster(m.ipMap, m.localID) {
+		pending := unconfirmed(m.hallOrders)
+		m.hallOrders = applyNewOrderBarrier(m.hallOrders, m.hallOrdersMap, m.ipMap)
+		m.recordCalls(pending, now)
+		m.updateTrafficMode(now)
+		m.assignDestinations(m.hallOrders)
+	}
+	data := m.networkData(now)
+	if util.IsMaster(m.ipMap, m.localID) {
+		m.trackHandoffs(data, now)
+		m.adoptAssignments(data)
+		strategy := m.parkingMode
+		if m.trafficMode == UpPeak {
+			strategy = parkAtLobby
+		}
+		// Once set, parking is kept up to date so the floors can be cleared again
+		if strategy != "" && (strategy != ParkNone || m.parking != nil) {
+			m.parking = parkingTargets(strategy, data, m.flagged, m.parking, now)
+			data.Parking = m.parking
+		}
+	}
+	return data
 }
 
-func sendNetworkData(
-	localID string,
-	states map[string]structs.HRAElevState,
-	orders []structs.HallOrder,
-	outChan chan<- structs.ElevatorDataWithID,
-	ipMap map[string]time.Time,
-) {
+func (m *orderManager) removePeer(ip string) {
+	delete(m.ipMap, ip)
+	delete(m.elevatorStates, ip)
+	delete(m.hallOrdersMap, ip)
+	delete(m.peerSeq, ip)
+	delete(m.flagged, ip)
+}
+
+// handleIncoming merges a message from another elevator into the local view.
+// It returns true if a Delta from the sender has been missed, in which case
+// the caller should ask it for a Snapshot.
+func (m *orderManager) handleIncoming(incomingData structs.ElevatorDataWithID, now time.Time) bool {
+	sender := incomingData.ElevatorID
+	_, seen := m.ipMap[sender]
+	m.ipMap[sender] = now
+	if !seen {
+		m.updateView()
+	}
+	if incomingData.Kind == structs.SnapshotRequest {
+		if incomingData.Target == m.localID {
+			m.snapshotWanted = true
+		}
+		return false
+	}
+
+	lastSeq, known := m.peerSeq[sender]
+	m.peerSeq[sender] = incomingData.Seq
+	if incomingData.Kind == structs.Snapshot {
+		m.hallOrdersMap[sender] = incomingData.HallOrders
+	} else {
+		m.hallOrdersMap[sender] = patchOrders(m.hallOrdersMap[sender], incomingData.HallOrders)
+	}
+	for id, state := range incomingData.ElevatorState {
+		if sender == id {
+			m.elevatorStates[id] = state
+		}
+	}
+	m.mergeRecall(sender, incomingData.Recall)
+	for _, newOrder := range incomingData.HallOrders {
+		m.mergeOrder(sender, incomingData.View, newOrder)
+	}
+	for _, call := range incomingData.Destinations {
+		m.mergeDestination(sender, call)
+	}
+	if m.recall.Active {
+		m.hallOrders = cancelAllOrders(m.hallOrders)
+		m.cancelAllDestinations()
+	}
+	// Parking floors are taken from the master, and a Snapshot without them clears them
+	if util.IsMaster(m.ipMap, sender) && incomingData.View == m.view {
+		if incomingData.Kind == structs.Snapshot || incomingData.Parking != nil {
+			m.parking = incomingData.Parking
+		}
+		if incomingData.Traffic != "" {
+			m.trafficMode = TrafficMode(incomingData.Traffic)
+		}
+	}
+	m.acknowledgeAll()
+	return incomingData.Kind == structs.Delta && (!known || incomingData.Seq != lastSeq+1)
+}
+
+// patchOrders returns orders with the orders in a Delta replacing their old versions.
+func patchOrders(orders []structs.HallOrder, changed []structs.HallOrder) []structs.HallOrder {
+	patched := make([]structs.HallOrder, len(orders), len(orders)+len(changed))
+	copy(patched, orders)
+	for _, order := range changed {
+		if i := findOrder(patched, order.Floor, order.Dir); i >= 0 {
+			patched[i] = order
+		} else {
+			patched = append(patched, order)
+		}
+	}
+	return patched
+}
+
+// mergeOrder folds an order reported by senderID into the local table.
+// Unknown orders are always adopted. If the presses differ, the order that
+// covers the other wins, and if neither does both are merged into a new order
+// that has to be confirmed again, so no press is lost to a stale copy.
+// For the same presses the master's view wins, while the master itself only
+// accepts completions reported by the elevator the order was assigned to,
+// unless the sender was in another view and the two are reconciled instead.
+// Either way the change has to be a legal lifecycle transition. A copy the
+// sender has acknowledged completes the master's handoff of the order.
+func (m *orderManager) mergeOrder(senderID string, senderView structs.ViewID, newOrder structs.HallOrder) {
+	i := findOrder(m.hallOrders, newOrder.Floor, newOrder.Dir)
+	if i < 0 {
+		m.hallOrders = append(m.hallOrders, newOrder)
+		return
+	}
+	order := m.hallOrders[i]
+
+	if !order.Presses.Equal(newOrder.Presses) {
+		switch {
+		case newOrder.Presses.Covers(order.Presses):
+			m.hallOrders[i] = newOrder
+		case order.Presses.Covers(newOrder.Presses):
+		default:
+			m.hallOrders[i] = newPress(order.Floor, order.Dir, order.Presses.Merge(newOrder.Presses))
+			m.hallOrders[i].Priority = highest(order.Priority, newOrder.Priority)
+		}
+		return
+	}
+	if newOrder.AckedBy == senderID {
+		m.ackHandoff(senderID, newOrder)
+	}
+
+	if senderView != m.view {
+		m.reconcileOrder(i, senderID, senderView, newOrder)
+		return
+	}
+
+	accept := false
+	switch {
+	case newOrder.Status == structs.Cancelled:
+		// A call can be taken back from any elevator
+		accept = true
+	case util.IsMaster(m.ipMap, senderID):
+		accept = true
+	case util.IsMaster(m.ipMap, m.localID):
+		accept = newOrder.Status == structs.Completed && order.DelegatedID == senderID
+	}
+
+	if accept && order.Status.CanTransitionTo(newOrder.Status) {
+		m.hallOrders[i].Status = newOrder.Status
+		m.hallOrders[i].DelegatedID = newOrder.DelegatedID
+		m.hallOrders[i].AssignedBy = newOrder.AssignedBy
+		m.hallOrders[i].ETA = newOrder.ETA
+	}
+}
+
+// handleLocalOrder adds a hall button press from this elevator. The press
+// starts a new order unless the call is already confirmed or assigned, in
+// which case it joins the order without setting it back to New. A press
+// with a higher priority raises that of a call that is still waiting, which
+// takes a new order so the raise reaches the master. An order with status
+// Cancelled takes the call back instead.
+func (m *orderManager) handleLocalOrder(localOrder structs.HallOrder, now time.Time) {
+	if m.recall.Active {
+		return
+	}
+	if localOrder.Status == structs.Cancelled {
+		m.cancelOrder(localOrder.Floor, localOrder.Dir)
+		return
+	}
+	stamp := now.UnixNano() / int64(time.Millisecond)
+	i := findOrder(m.hallOrders, localOrder.Floor, localOrder.Dir)
+	if i < 0 {
+		m.hallOrders = append(m.hallOrders, newPress(localOrder.Floor, localOrder.Dir, structs.PressVector{}.With(m.localID, stamp)))
+		m.hallOrders[len(m.hallOrders)-1].Priority = localOrder.Priority
+		return
+	}
+	priority := localOrder.Priority
+	if !ended(m.hallOrders[i].Status) {
+		if m.hallOrders[i].Status != structs.New && priority <= m.hallOrders[i].Priority {
+			// Joining keeps the press if this copy turns out to be stale
+			m.hallOrders[i].Presses = m.hallOrders[i].Presses.With(m.localID, stamp)
+			return
+		}
+		priority = highest(priority, m.hallOrders[i].Priority)
+	}
+	m.hallOrders[i] = newPress(localOrder.Floor, localOrder.Dir, m.hallOrders[i].Presses.With(m.localID, stamp))
+	m.hallOrders[i].Priority = priority
+}
+
+// cancelOrder takes back the call at floor and dir if it has not been served.
+// The other elevators take the cancellation from this one, which turns the
+// lamps off and removes the call from the requests of the elevator it was
+// assigned to.
+func (m *orderManager) cancelOrder(floor int, dir elevio.ButtonType) {
+	i := findOrder(m.hallOrders, floor, dir)
+	if i < 0 || ended(m.hallOrders[i].Status) {
+		return
+	}
+	m.hallOrders[i].Status = structs.Cancelled
+	m.logf("Cancelled hall call at floor %d %s\n", floor, dirName(dir))
+}
+
+// ended reports whether an order has been served or cancelled.
+func ended(status structs.OrderStatus) bool {
+	return status == structs.Completed || status == structs.Cancelled
+}
+
+func newPress(floor int, dir elevio.ButtonType, presses structs.PressVector) structs.HallOrder {
+	return structs.HallOrder{
+		Status:      structs.New,
+		DelegatedID: "undelegated",
+		Floor:       floor,
+		Dir:         dir,
+		Presses:     presses,
+	}
+}
+
+// handleCompleted marks the hall stops the FSM has served. A hall order is
+// only completed if it is delegated to this elevator, since a stop made for a
+// destination call may be at a floor where another car holds the hall call.
+func (m *orderManager) handleCompleted(completedReqs []elevio.ButtonEvent, now time.Time) {
+	for _, req := range completedReqs {
+		m.pickUp(req)
+		i := findOrder(m.hallOrders, req.Floor, req.Button)
+		if i < 0 || m.hallOrders[i].DelegatedID != m.localID {
+			continue
+		}
+		m.recordArrival(m.hallOrders[i], now)
+		m.hallOrders = updateOrderStatus(m.hallOrders, req.Floor, int(req.Button), structs.Completed)
+	}
+}
+
+func findOrder(orders []structs.HallOrder, floor int, dir elevio.ButtonType) int {
+	for i, order := range orders {
+		if order.Floor == floor && order.Dir == dir {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *orderManager) networkData(now time.Time) structs.ElevatorDataWithID {
+	networkData := m.localData()
+	if util.IsMaster(m.ipMap, m.localID) {
+		networkData.HallOrders = assignOrders(networkData, m.assign, m.flagged, m.trafficMode == DownPeak).HallOrders
+		stampAssigner(networkData.HallOrders, m.hallOrders, m.localID)
+		m.setETAs(networkData, now)
+	}
+	return networkData
+}
+
+// localData returns the states and orders as this node has them, without
+// running the assigner.
+func (m *orderManager) localData() structs.ElevatorDataWithID {
 	statesCopy := make(map[string]structs.HRAElevState)
-	for id, state := range states {
+	for id, state := range m.elevatorStates {
 		statesCopy[id] = state
 	}
 
-	ordersCopy := make([]structs.HallOrder, len(orders))
-	copy(ordersCopy, orders)
+	ordersCopy := make([]structs.HallOrder, len(m.hallOrders))
+	copy(ordersCopy, m.hallOrders)
 
 	networkData := structs.ElevatorDataWithID{
-		ElevatorID:    localID,
+		ElevatorID:    m.localID,
 		ElevatorState: statesCopy,
 		HallOrders:    ordersCopy,
 	}
 
-	if util.IsMaster(ipMap, localID) {
-		networkData = assignOrders(networkData)
+	if util.IsMaster(m.ipMap, m.localID) {
+		networkData.Parking = m.parking
+		networkData.Traffic = string(m.trafficMode)
+	}
+	networkData.View = m.view
+	networkData.Recall = m.recallMessage()
+	networkData.Destinations = cloneDestinations(m.dest.calls)
+	return networkData
+}
+
+// nextMessage returns the message that brings the other elevators up to view:
+// a Snapshot if one is due or has been asked for, otherwise a Delta with the
+// local state and orders that changed since the last message. It returns
+// false if there is nothing to send. Only the local elevator's state is sent,
+// since receivers ignore the states an elevator reports for others.
+func (m *orderManager) nextMessage(view structs.ElevatorDataWithID, now time.Time) (structs.ElevatorDataWithID, bool) {
+	msg := structs.ElevatorDataWithID{
+		ElevatorID:    m.localID,
+		ElevatorState: make(map[string]structs.HRAElevState),
+		Seq:           m.seq + 1,
+		View:          view.View,
+	}
+	state, hasState := view.ElevatorState[m.localID]
+
+	if m.snapshotWanted || now.Sub(m.lastSnapshot) >= config.SnapshotIntervalMs*time.Millisecond {
+		msg.Kind = structs.Snapshot
+		if hasState {
+			msg.ElevatorState[m.localID] = state
+		}
+		msg.HallOrders = view.HallOrders
+		msg.Parking = view.Parking
+		msg.Traffic = view.Traffic
+		msg.Recall = view.Recall
+		msg.Destinations = view.Destinations
+		return msg, true
+	}
+
+	msg.Kind = structs.Delta
+	if sentState, sent := m.lastSent.ElevatorState[m.localID]; hasState && (!sent || !sameElevState(sentState, state)) {
+		msg.ElevatorState[m.localID] = state
+	}
+	for _, order := range view.HallOrders {
+		j := findOrder(m.lastSent.HallOrders, order.Floor, order.Dir)
+		if j < 0 || !sameOrder(m.lastSent.HallOrders[j], order) {
+			msg.HallOrders = append(msg.HallOrders, order)
+		}
+	}
+	if !sameParking(m.lastSent.Parking, view.Parking) {
+		msg.Parking = view.Parking
+	}
+	if m.lastSent.Traffic != view.Traffic {
+		msg.Traffic = view.Traffic
 	}
-	setAllLights(networkData)
+	if !sameRecall(m.lastSent.Recall, view.Recall) {
+		msg.Recall = view.Recall
+	}
+	msg.Destinations = changedDestinations(m.lastSent.Destinations, view.Destinations)
+	return msg, len(msg.ElevatorState) > 0 || len(msg.HallOrders) > 0 || msg.Parking != nil || msg.Traffic != "" ||
+		msg.Recall != nil || len(msg.Destinations) > 0
+}
 
+// publish sends the next message for view, if there is one. A message that
+// would block is dropped without using up its Seq, so its changes simply go
+// out with the next one.
+func (m *orderManager) publish(view structs.ElevatorDataWithID, now time.Time, outgoingDataChan chan<- structs.ElevatorDataWithID) {
+	msg, ok := m.nextMessage(view, now)
+	if !ok {
+		return
+	}
 	select {
-	case outChan <- networkData:
+	case outgoingDataChan <- msg:
+		m.seq = msg.Seq
+		m.lastSent = view
+		if msg.Kind == structs.Snapshot {
+			m.lastSnapshot = now
+			m.snapshotWanted = false
+		}
 	default:
 	}
 }
 
+// unsent returns true if the local state or an order has changed since the
+// last message, or a Snapshot has been asked for.
+func (m *orderManager) unsent() bool {
+	if m.snapshotWanted {
+		return true
+	}
+	state, hasState := m.elevatorStates[m.localID]
+	if sentState, sent := m.lastSent.ElevatorState[m.localID]; hasState && (!sent || !sameElevState(sentState, state)) {
+		return true
+	}
+	for _, order := range m.hallOrders {
+		j := findOrder(m.lastSent.HallOrders, order.Floor, order.Dir)
+		if j < 0 || !sameOrder(m.lastSent.HallOrders[j], order) {
+			return true
+		}
+	}
+	if !sameRecall(m.lastSent.Recall, m.recallMessage()) || len(changedDestinations(m.lastSent.Destinations, m.dest.calls)) > 0 {
+		return true
+	}
+	return util.IsMaster(m.ipMap, m.localID) &&
+		(!sameParking(m.lastSent.Parking, m.parking) || m.lastSent.Traffic != string(m.trafficMode))
+}
+
+func snapshotRequest(localID string, target string) structs.ElevatorDataWithID {
+	return structs.ElevatorDataWithID{
+		ElevatorID: localID,
+		Kind:       structs.SnapshotRequest,
+		Target:     target,
+	}
+}
+
+func sameOrder(a structs.HallOrder, b structs.HallOrder) bool {
+	return a.Status == b.Status && a.DelegatedID == b.DelegatedID && a.AckedBy == b.AckedBy && a.ETA == b.ETA &&
+		a.Priority == b.Priority && a.AssignedBy == b.AssignedBy && a.Presses.Equal(b.Presses)
+}
+
+func sameElevState(a structs.HRAElevState, b structs.HRAElevState) bool {
+	if a.Obstruction != b.Obstruction || a.Stop != b.Stop || a.Maintenance != b.Maintenance || a.LoadKg != b.LoadKg || a.Behavior != b.Behavior ||
+		a.Floor != b.Floor || a.Direction != b.Direction || len(a.CabRequests) != len(b.CabRequests) {
+		return false
+	}
+	for i := range a.CabRequests {
+		if a.CabRequests[i] != b.CabRequests[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stampAssigner sets AssignedBy on the orders in assigned. An order that
+// was already assigned to the same elevator keeps the master that did so,
+// others are stamped with masterID.
+func stampAssigner(assigned []structs.HallOrder, current []structs.HallOrder, masterID string) {
+	for i, order := range assigned {
+		if order.Status != structs.Assigned {
+			continue
+		}
+		assigned[i].AssignedBy = masterID
+		if j := findOrder(current, order.Floor, order.Dir); j >= 0 {
+			old := current[j]
+			if old.Status == structs.Assigned && old.DelegatedID == order.DelegatedID && old.Presses.Equal(order.Presses) && old.AssignedBy != "" {
+				assigned[i].AssignedBy = old.AssignedBy
+			}
+		}
+	}
+}
+
 func updateOrderStatus(orders []structs.HallOrder, floor int, dir int, newStatus structs.OrderStatus) []structs.HallOrder {
 	for i, order := range orders {
 		if order.Floor == floor && int(order.Dir) == dir {
-			orders[i].Status = newStatus
+			if order.Status.CanTransitionTo(newStatus) {
+				orders[i].Status = newStatus
+			}
 			break
 		}
 	}
 	return orders
 }
 
-// assignOrders checks if the local elevator is the master and
-// assigns orders accordingly using the runHRA package.
-func assignOrders(data structs.ElevatorDataWithID) structs.ElevatorDataWithID {
+// assignOrders is run by the master and assigns the pending orders using
+// the given assigner, normally runHRA.RunHRA. Elevators that are obstructed,
+// stopped or in maintenance never get orders, while excluded and full
+// elevators only get them if there is no other elevator. Exclusive calls get
+// a car each first, and priority calls are assigned next, so the assigner
+// sees them as stops the cars already have when it places the normal calls.
+// Assignments are then kept where they were unless moving them gains enough,
+// and if zoned, each elevator finally takes the normal calls in its zone.
+func assignOrders(data structs.ElevatorDataWithID, assign func(structs.ElevatorDataWithID) structs.ElevatorDataWithID, excluded map[string]elevatorFlag, zoned bool) structs.ElevatorDataWithID {
     var pendingOrders []structs.HallOrder
     var nonPendingOrders []structs.HallOrder
 
     for _, order := range data.HallOrders {
-        if order.Status == structs.Completed || order.Status == structs.New{
+        if ended(order.Status) || order.Status == structs.New{
             nonPendingOrders = append(nonPendingOrders, order)
         } else {
             pendingOrders = append(pendingOrders, order)
         }
     }
 
+	// newElevState holds the elevators that can take orders
 	newElevState := make(map[string]structs.HRAElevState)
-	test := make(map[string]structs.HRAElevState)
     for key, state := range data.ElevatorState {
-        if !(state.Obstruction || state.Stop){
+        if !(state.Obstruction || state.Stop || state.Maintenance){
             newElevState[key] = state
-        } else{
-			test[key] = state
-		}
+        }
     }
+	newElevState = preferring(newElevState, func(key string, state structs.HRAElevState) bool {
+		_, isExcluded := excluded[key]
+		return !isExcluded
+	})
+	// A full elevator cannot take anyone on, so it only gets calls if all are full
+	newElevState = preferring(newElevState, func(key string, state structs.HRAElevState) bool {
+		return state.LoadKg < config.FullLoadKg
+	})
+
+	exclusive, priority, normal := byPriority(pendingOrders)
+	reserved, waiting, free := reserveCars(exclusive, newElevState)
+	if len(free) == 0 {
+		// Every car is on exclusive service, so the rest wait as they are
+		waiting = append(waiting, priority...)
+		waiting = append(waiting, normal...)
+		priority, normal = nil, nil
+		free = newElevState
+	}
 
     dataForHRA := data
-	dataForHRA.ElevatorState = newElevState
-    dataForHRA.HallOrders = pendingOrders
-
-    newData := runHRA.RunHRA(dataForHRA)
+	dataForHRA.ElevatorState = free
+	var first []structs.HallOrder
+	if len(priority) > 0 {
+		dataForHRA.HallOrders = priority
+		first = assign(dataForHRA).HallOrders
+		dataForHRA.ElevatorState = committedStops(free, first)
+	}
+    dataForHRA.HallOrders = normal
+
+    newData := assign(dataForHRA)
+	newData.HallOrders = append(first, newData.HallOrders...)
+	// The assigner only knows floors and directions, so carry over which presses each order is for
+	for i, order := range newData.HallOrders {
+		if j := findOrder(pendingOrders, order.Floor, order.Dir); j >= 0 {
+			newData.HallOrders[i].Presses = pendingOrders[j].Presses
+			newData.HallOrders[i].Priority = pendingOrders[j].Priority
+		}
+	}
+	keepAssignments(pendingOrders, newData.HallOrders, free, config.ReassignMarginMs*time.Millisecond)
+	if zoned {
+		// Zones come after the sticky assignments so calls move when the mode changes
+		zoneAssignments(newData.HallOrders[len(first):], free)
+	}
+    newData.HallOrders = append(newData.HallOrders, reserved...)
+    newData.HallOrders = append(newData.HallOrders, waiting...)
     newData.HallOrders = append(newData.HallOrders, nonPendingOrders...)
 	newData.ElevatorState = data.ElevatorState
+    return newData
+}
 
-	for key, state := range data.ElevatorState {
-		if !(state.Obstruction || state.Stop) {
-			newElevState[key] = state
-		} else {
-			test[key] = state
+
+// preferring returns the elevators in states that pass keep, or all of them if none does.
+func preferring(states map[string]structs.HRAElevState, keep func(string, structs.HRAElevState) bool) map[string]structs.HRAElevState {
+	kept := make(map[string]structs.HRAElevState)
+	for key, state := range states {
+		if keep(key, state) {
+			kept[key] = state
 		}
 	}
-    return newData
+	if len(kept) == 0 {
+		return states
+	}
+	return kept
 }
 
-
 // orderKnownByAll returns true if every active node
-// has an order with the same Floor and Dir that is still marked as New (or already Confirmed)
+// has the same presses of the button that are still marked as New (or already Confirmed)
 func orderKnownByAll(order structs.HallOrder, hallOrdersMap map[string][]structs.HallOrder, ipList []string) bool {
 
     for _, nodeID := range ipList {
@@ -234,7 +703,7 @@ func orderKnownByAll(order structs.HallOrder, hallOrdersMap map[string][]structs
         }
         found := false
         for _, o := range orders {
-            if o.Floor == order.Floor && o.Dir == order.Dir &&
+            if o.Floor == order.Floor && o.Dir == order.Dir && o.Presses.Equal(order.Presses) &&
                 (o.Status == structs.New || o.Status == structs.Confirmed) {
                 found = true
                 break
@@ -266,23 +735,16 @@ func applyNewOrderBarrier(orders []structs.HallOrder, hallOrdersMap map[string][
 
 func getMyRequests(hallOrders []structs.HallOrder, elevatorStates map[string]structs.HRAElevState, myID string) [config.N_FLOORS][config.N_BUTTONS]bool {
     var orders [config.N_FLOORS][config.N_BUTTONS]bool
-    
-    // If only one elevator is active, take all hall orders
-    if len(elevatorStates) == 1 {
-        for _, order := range hallOrders {
-            if order.Status == structs.Assigned {
-                orders[order.Floor][order.Dir] = true
-            }
-        }
-    }
+	state, ok := elevatorStates[myID]
 
+	// An elevator in maintenance lets go of its hall orders at once, the master reassigns them
 	for _, order := range hallOrders {
-		if order.DelegatedID == myID && order.Status == structs.Assigned {
+		if order.DelegatedID == myID && order.Status == structs.Assigned && !state.Maintenance {
 			orders[order.Floor][order.Dir] = true
 		}
 	}
 
-	if state, ok := elevatorStates[myID]; ok {
+	if ok {
 		for floorIndex := 0; floorIndex < len(state.CabRequests); floorIndex++ {
 			if state.CabRequests[floorIndex] {
 				orders[floorIndex][elevio.BT_Cab] = true
@@ -294,17 +756,22 @@ func getMyRequests(hallOrders []structs.HallOrder, elevatorStates map[string]str
 }
 
 
-func setAllLights(data structs.ElevatorDataWithID) {
+func hallLights(data structs.ElevatorDataWithID) [config.N_FLOORS][2]bool {
 	var hallLightsOn [config.N_FLOORS][2]bool
 
 	for _, order := range data.HallOrders {
 		buttonType := int(order.Dir)
 		if buttonType == int(elevio.BT_HallUp) || buttonType == int(elevio.BT_HallDown) {
-			if order.Status == structs.Confirmed || order.Status == structs.Assigned {
+			if order.Status.IsActive() {
 				hallLightsOn[order.Floor][buttonType] = true
 			}
 		}
 	}
+	return hallLightsOn
+}
+
+func setAllLights(data structs.ElevatorDataWithID) {
+	hallLightsOn := hallLights(data)
 
 	for floor := 0; floor < config.N_FLOORS; floor++ {
 		elevio.SetButtonLamp(elevio.BT_HallUp, floor, hallLightsOn[floor][int(elevio.BT_HallUp)])
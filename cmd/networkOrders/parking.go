@@ -0,0 +1,183 @@
+package networkOrders
+
+import (
+	"fmt"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"sort"
+	"time"
+)
+
+// ParkingStrategy decides where the master sends elevators that have
+// nothing to do. No two elevators are sent to the same floor.
+type ParkingStrategy string
+
+const (
+	// ParkNone leaves idle elevators where they are.
+	ParkNone ParkingStrategy = "none"
+	// ParkLobby sends one idle elevator to the lobby and spreads the rest.
+	ParkLobby ParkingStrategy = "lobby"
+	// ParkSpread spreads idle elevators evenly over the floors.
+	ParkSpread ParkingStrategy = "spread"
+	// ParkSchedule uses the floors in config.ParkingSchedule for the time
+	// of day and spreads the rest.
+	ParkSchedule ParkingStrategy = "schedule"
+
+	// parkAtLobby parks idle elevators as close to the lobby as they can
+	// during up-peak, one at the lobby and the rest on the floors nearest it.
+	parkAtLobby ParkingStrategy = "up-peak"
+)
+
+// ParseParkingStrategy checks a strategy given on the command line.
+func ParseParkingStrategy(name string) (ParkingStrategy, error) {
+	switch strategy := ParkingStrategy(name); strategy {
+	case ParkNone, ParkLobby, ParkSpread, ParkSchedule:
+		return strategy, nil
+	}
+	return ParkNone, fmt.Errorf("unknown parking strategy %q", name)
+}
+
+// parkingFloors returns the floors n idle elevators should wait at, the
+// most important first.
+func parkingFloors(strategy ParkingStrategy, n int, now time.Time) []int {
+	var preferred []int
+	switch strategy {
+	case ParkLobby:
+		preferred = []int{config.LobbyFloor}
+	case ParkSchedule:
+		hour := now.Hour()
+		for _, period := range config.ParkingSchedule {
+			if hour >= period.FromHour && hour < period.ToHour {
+				preferred = period.Floors
+			}
+		}
+	case parkAtLobby:
+		for distance := 0; distance < config.N_FLOORS; distance++ {
+			preferred = append(preferred, config.LobbyFloor+distance, config.LobbyFloor-distance)
+		}
+	case ParkSpread:
+	default:
+		return nil
+	}
+
+	floors := make([]int, 0, n)
+	taken := make(map[int]bool)
+	for _, floor := range preferred {
+		if len(floors) < n && floor >= 0 && floor < config.N_FLOORS && !taken[floor] {
+			floors = append(floors, floor)
+			taken[floor] = true
+		}
+	}
+	// Spread the rest evenly over the floors that are left
+	var free []int
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		if !taken[floor] {
+			free = append(free, floor)
+		}
+	}
+	rest := n - len(floors)
+	if rest > len(free) {
+		rest = len(free)
+	}
+	for i := 0; i < rest; i++ {
+		floors = append(floors, free[(2*i+1)*len(free)/(2*rest)])
+	}
+	return floors
+}
+
+// parkingTargets gives each idle elevator a floor to wait at. An elevator is
+// idle if it has no cab calls and no hall orders, even while it is on its
+// way to park. Elevators keep the floor they were given as long as it is
+// still wanted, and the other floors go to the nearest idle elevator.
+func parkingTargets(strategy ParkingStrategy, data structs.ElevatorDataWithID, excluded map[string]elevatorFlag, previous map[string]int, now time.Time) map[string]int {
+	targets := make(map[string]int)
+	var idle []string
+	for id, state := range data.ElevatorState {
+		targets[id] = -1
+		if _, isExcluded := excluded[id]; !isExcluded && isIdle(id, state, data.HallOrders) {
+			idle = append(idle, id)
+		}
+	}
+	sort.Strings(idle)
+
+	// wanted counts how many elevators each floor still needs
+	wanted := make(map[int]int)
+	floors := parkingFloors(strategy, len(idle), now)
+	for _, floor := range floors {
+		wanted[floor]++
+	}
+
+	parked := make(map[string]bool)
+	for _, id := range idle {
+		if floor, ok := previous[id]; ok && wanted[floor] > 0 {
+			targets[id] = floor
+			parked[id] = true
+			wanted[floor]--
+		}
+	}
+	for _, floor := range floors {
+		if wanted[floor] == 0 {
+			continue
+		}
+		wanted[floor]--
+		best := ""
+		for _, id := range idle {
+			if parked[id] {
+				continue
+			}
+			if best == "" || abs(data.ElevatorState[id].Floor-floor) < abs(data.ElevatorState[best].Floor-floor) {
+				best = id
+			}
+		}
+		if best == "" {
+			break
+		}
+		targets[best] = floor
+		parked[best] = true
+	}
+	return targets
+}
+
+func isIdle(id string, state structs.HRAElevState, orders []structs.HallOrder) bool {
+	if state.Obstruction || state.Stop || state.Maintenance {
+		return false
+	}
+	for _, cab := range state.CabRequests {
+		if cab {
+			return false
+		}
+	}
+	for _, order := range orders {
+		if order.Status == structs.Assigned && order.DelegatedID == id {
+			return false
+		}
+	}
+	return true
+}
+
+// parkFloor is where the local elevator should wait while idle, -1 for anywhere.
+func (m *orderManager) parkFloor() int {
+	if floor, ok := m.parking[m.localID]; ok {
+		return floor
+	}
+	return -1
+}
+
+func sameParking(a map[string]int, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, floor := range a {
+		if other, ok := b[id]; !ok || other != floor {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
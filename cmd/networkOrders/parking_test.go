@@ -0,0 +1,74 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"reflect"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestParkingFloors(t *testing.T) {
+	tests := []struct {
+		strategy ParkingStrategy
+		n        int
+		want     []int
+	}{
+		{ParkNone, 2, nil},
+		{ParkSpread, 1, []int{2}},
+		{ParkSpread, 2, []int{1, 3}},
+		{ParkLobby, 2, []int{0, 2}},
+		{ParkSpread, 6, []int{0, 1, 2, 3}},
+		{parkAtLobby, 1, []int{0}},
+		{parkAtLobby, 3, []int{0, 1, 2}},
+		{parkAtLobby, 6, []int{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		got := parkingFloors(tt.strategy, tt.n, mcEpoch)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parkingFloors(%s, %d) = %v, want %v", tt.strategy, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestParkingTargets(t *testing.T) {
+	data := structs.ElevatorDataWithID{
+		ElevatorState: map[string]structs.HRAElevState{"a": structs.IdleAt(0), "b": structs.IdleAt(3), "c": structs.IdleAt(1)},
+		HallOrders:    []structs.HallOrder{{Floor: 2, Dir: elevio.BT_HallUp, Status: structs.Assigned, DelegatedID: "c"}},
+	}
+	targets := parkingTargets(ParkLobby, data, nil, nil, mcEpoch)
+	want := map[string]int{"a": 0, "b": 2, "c": -1}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets %v, want %v", targets, want)
+	}
+
+	// An elevator keeps a floor that is still wanted even if another is closer
+	targets = parkingTargets(ParkLobby, data, nil, map[string]int{"b": 0}, mcEpoch)
+	want = map[string]int{"a": 2, "b": 0, "c": -1}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets %v, want %v", targets, want)
+	}
+}
+
+func TestPeerTakesParkingFromMaster(t *testing.T) {
+	master, peer := handoffPair()
+	master.parkingMode = ParkSpread
+	now := mcEpoch.Add(time.Second)
+
+	out := make(chan structs.ElevatorDataWithID, 1)
+	master.publish(master.tick(now), now, out)
+	peer.handleIncoming(<-out, now)
+
+	if got := master.parkFloor(); got != 2 {
+		t.Errorf("master parks at %d, want 2", got)
+	}
+	if got := peer.parkFloor(); got != -1 {
+		t.Errorf("peer with an order parks at %d, want -1", got)
+	}
+	if !reflect.DeepEqual(peer.parking, master.parking) {
+		t.Errorf("peer has parking %v, master %v", peer.parking, master.parking)
+	}
+}
@@ -0,0 +1,117 @@
+package networkOrders
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sanntids/cmd/structs"
+	"sanntids/cmd/util"
+	"sort"
+	"strings"
+	"time"
+)
+
+// viewOf returns the view of a node that sees the elevators in ipMap. It
+// names the master and hashes the members, so every node that sees the
+// same elevators agrees on it and nodes in different partitions do not.
+func viewOf(localID string, ipMap map[string]time.Time) structs.ViewID {
+	members := viewMembers(localID, ipMap)
+	master := "none"
+	for _, id := range members {
+		if util.IsMaster(ipMap, id) {
+			master = id
+			break
+		}
+	}
+	hash := sha256.Sum256([]byte(strings.Join(members, ",")))
+	return structs.ViewID(fmt.Sprintf("%s/%x", master, hash[:4]))
+}
+
+func viewMembers(localID string, ipMap map[string]time.Time) []string {
+	members := []string{localID}
+	for id := range ipMap {
+		if id != localID {
+			members = append(members, id)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// updateView recomputes the view after the set of live elevators may have changed.
+func (m *orderManager) updateView() {
+	view := viewOf(m.localID, m.ipMap)
+	if view == m.view {
+		return
+	}
+	m.logf("View changed from %s to %s, members %v\n", m.view, view, viewMembers(m.localID, m.ipMap))
+	m.view = view
+}
+
+// reconcileOrder merges a copy of an order for the same presses from an
+// elevator that was in another view, i.e. on the other side of a partition
+// that has just healed. Both sides may have confirmed, assigned or served
+// the presses on their own, so the copy that got furthest in the lifecycle
+// wins: a completed order has been served, a cancelled one is not wanted,
+// and an active one must be kept until it is. Between two assigned copies the lower DelegatedID wins, which
+// only matters until the master reassigns the order. Every conflict is logged.
+func (m *orderManager) reconcileOrder(i int, senderID string, senderView structs.ViewID, newOrder structs.HallOrder) {
+	order := m.hallOrders[i]
+	if order.Status == newOrder.Status && order.DelegatedID == newOrder.DelegatedID {
+		return
+	}
+
+	// Statuses are declared in lifecycle order
+	winner := order
+	if newOrder.Status > order.Status ||
+		(newOrder.Status == order.Status && newOrder.DelegatedID < order.DelegatedID) {
+		winner = newOrder
+	}
+	if !order.Status.CanTransitionTo(winner.Status) {
+		winner = order
+	}
+	m.hallOrders[i].Status = winner.Status
+	m.hallOrders[i].DelegatedID = winner.DelegatedID
+	m.hallOrders[i].AssignedBy = winner.AssignedBy
+	m.hallOrders[i].ETA = winner.ETA
+
+	m.logf("Conflict on floor %d dir %d with %s (view %s): had %v@%s, got %v@%s, keeping %v@%s\n",
+		order.Floor, order.Dir, senderID, senderView,
+		order.Status, order.DelegatedID, newOrder.Status, newOrder.DelegatedID,
+		winner.Status, winner.DelegatedID)
+}
+
+// updateIsolation enters or leaves degraded mode. A node is isolated when it
+// hears no other elevator, which is also what happens when its own network
+// interface is down, as it then does not even hear itself.
+func (m *orderManager) updateIsolation() {
+	isolated := true
+	for id := range m.ipMap {
+		if id != m.localID {
+			isolated = false
+		}
+	}
+	if isolated == m.isolated {
+		return
+	}
+	if isolated {
+		m.logf("Lost all peers, serving every hall call locally\n")
+	} else {
+		m.logf("Peers are back, handing hall calls back to the master\n")
+	}
+	m.isolated = isolated
+}
+
+// takeAllOrders assigns every unserved order to the local elevator. An
+// isolated node cannot rely on anyone else, so without this a call pressed on
+// its panel would be lit but never served. When peers return, the orders are
+// reconciled as after any partition and the master reassigns them.
+func takeAllOrders(orders []structs.HallOrder, localID string) []structs.HallOrder {
+	for i, order := range orders {
+		if !ended(order.Status) {
+			orders[i].Status = structs.Assigned
+			orders[i].DelegatedID = localID
+			orders[i].AssignedBy = localID
+		}
+	}
+	return orders
+}
@@ -0,0 +1,151 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"fmt"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+// partitionedPair returns two nodes that shared a confirmed order for
+// mcCall before the network split, each now alone in its own view.
+func partitionedPair() (*orderManager, *orderManager, *[]string) {
+	var logged []string
+	a, b := mcNewNode(0), mcNewNode(1)
+	for _, m := range []*orderManager{a, b} {
+		m.logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+		m.hallOrders = []structs.HallOrder{{
+			Status:      structs.Confirmed,
+			DelegatedID: "undelegated",
+			Floor:       mcCall.Floor,
+			Dir:         mcCall.Button,
+			Presses:     structs.PressVector{a.localID: 1},
+		}}
+		m.tick(mcEpoch)
+	}
+	return a, b, &logged
+}
+
+// setStatus moves the node's order to status, assigned to the node itself if it is active.
+func setStatus(m *orderManager, status structs.OrderStatus) {
+	m.hallOrders[0].Status = status
+	if status != structs.Confirmed {
+		m.hallOrders[0].DelegatedID = m.localID
+	}
+}
+
+// tableOf is the node's order table as it would broadcast it, without assigning orders first.
+func tableOf(m *orderManager) structs.ElevatorDataWithID {
+	return structs.ElevatorDataWithID{
+		ElevatorID:    m.localID,
+		ElevatorState: m.elevatorStates,
+		HallOrders:    cloneOrders(m.hallOrders),
+		View:          m.view,
+	}
+}
+
+func TestPartitionsHaveDifferentViews(t *testing.T) {
+	a, b, _ := partitionedPair()
+	if a.view == b.view {
+		t.Fatalf("both partitions have view %s", a.view)
+	}
+	for _, m := range []*orderManager{a, b} {
+		m.ipMap[a.localID] = mcEpoch
+		m.ipMap[b.localID] = mcEpoch
+		m.tick(mcEpoch)
+	}
+	if a.view != b.view {
+		t.Fatalf("healed nodes disagree on the view: %s and %s", a.view, b.view)
+	}
+}
+
+func TestPartitionMergeKeepsServedAndUnservedCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b structs.OrderStatus
+		want structs.OrderStatus
+	}{
+		{"served on one side", structs.Assigned, structs.Completed, structs.Completed},
+		{"served on the other side", structs.Completed, structs.Assigned, structs.Completed},
+		{"assigned on one side", structs.Confirmed, structs.Assigned, structs.Assigned},
+		{"assigned on both sides", structs.Assigned, structs.Assigned, structs.Assigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, logged := partitionedPair()
+			setStatus(a, tt.a)
+			setStatus(b, tt.b)
+
+			fromA, fromB := tableOf(a), tableOf(b)
+			a.handleIncoming(fromB, mcEpoch)
+			b.handleIncoming(fromA, mcEpoch)
+
+			for _, m := range []*orderManager{a, b} {
+				if got := m.hallOrders[0].Status; got != tt.want {
+					t.Errorf("%s has %v, want %v", m.localID, got, tt.want)
+				}
+			}
+			if a.hallOrders[0].DelegatedID != b.hallOrders[0].DelegatedID {
+				t.Errorf("nodes disagree on the delegate: %s and %s", a.hallOrders[0].DelegatedID, b.hallOrders[0].DelegatedID)
+			}
+			if len(*logged) == 0 {
+				t.Errorf("conflict was not logged")
+			}
+		})
+	}
+}
+
+func TestSameViewUsesNormalMerge(t *testing.T) {
+	a, b, logged := partitionedPair()
+	for _, m := range []*orderManager{a, b} {
+		m.ipMap[a.localID] = mcEpoch
+		m.ipMap[b.localID] = mcEpoch
+		m.tick(mcEpoch)
+	}
+	*logged = nil
+
+	// b is not the master, so a does not take an assignment from it
+	setStatus(b, structs.Assigned)
+	a.handleIncoming(tableOf(b), mcEpoch.Add(time.Millisecond))
+	if got := a.hallOrders[0].DelegatedID; got != a.localID {
+		t.Errorf("master took the assignment to %s from a non-master", got)
+	}
+	if len(*logged) != 0 {
+		t.Errorf("unexpected log: %v", *logged)
+	}
+}
+
+func TestIsolatedNodeServesOwnCalls(t *testing.T) {
+	var logged []string
+	m := mcNewNode(1)
+	m.logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	m.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button}, mcEpoch)
+
+	data := m.tick(mcEpoch)
+	if !m.isolated {
+		t.Fatalf("node without peers is not isolated")
+	}
+	if !getMyRequests(m.hallOrders, m.elevatorStates, m.localID)[mcCall.Floor][mcCall.Button] {
+		t.Errorf("isolated node does not serve the call pressed on its panel")
+	}
+	if !hallLights(data)[mcCall.Floor][mcCall.Button] {
+		t.Errorf("lamp is not lit for a call that is being served")
+	}
+
+	m.handleCompleted([]elevio.ButtonEvent{mcCall}, mcEpoch)
+	if hallLights(m.tick(mcEpoch))[mcCall.Floor][mcCall.Button] {
+		t.Errorf("lamp stays lit after the call was served")
+	}
+
+	peer := mcNewNode(0)
+	m.handleIncoming(peer.networkData(mcEpoch), mcEpoch)
+	m.tick(mcEpoch)
+	if m.isolated {
+		t.Errorf("node is still isolated after hearing a peer")
+	}
+	if len(logged) == 0 || logged[0] != "Lost all peers, serving every hall call locally\n" ||
+		logged[len(logged)-1] != "Peers are back, handing hall calls back to the master\n" {
+		t.Errorf("entering and leaving degraded mode was not logged: %q", logged)
+	}
+}
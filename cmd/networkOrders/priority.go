@@ -0,0 +1,136 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/config"
+	"sanntids/cmd/eta"
+	"sanntids/cmd/structs"
+	"sort"
+)
+
+// byPriority splits orders by their priority.
+func byPriority(orders []structs.HallOrder) (exclusive []structs.HallOrder, priority []structs.HallOrder, normal []structs.HallOrder) {
+	for _, order := range orders {
+		switch order.Priority {
+		case structs.PriorityExclusive:
+			exclusive = append(exclusive, order)
+		case structs.PriorityHigh:
+			priority = append(priority, order)
+		default:
+			normal = append(normal, order)
+		}
+	}
+	return exclusive, priority, normal
+}
+
+// reserveCars gives each exclusive call a car of its own out of states. A
+// call keeps the car it has, and otherwise gets the empty car that can be
+// there first, or any car if none is empty. Calls left without a car are
+// returned as waiting, and free holds the cars that are left for other calls.
+func reserveCars(exclusive []structs.HallOrder, states map[string]structs.HRAElevState) (reserved []structs.HallOrder, waiting []structs.HallOrder, free map[string]structs.HRAElevState) {
+	free = make(map[string]structs.HRAElevState)
+	for id, state := range states {
+		free[id] = state
+	}
+	sort.Slice(exclusive, func(i, j int) bool {
+		if exclusive[i].Floor != exclusive[j].Floor {
+			return exclusive[i].Floor < exclusive[j].Floor
+		}
+		return exclusive[i].Dir < exclusive[j].Dir
+	})
+
+	var unplaced []structs.HallOrder
+	for _, order := range exclusive {
+		if _, ok := free[order.DelegatedID]; ok && order.Status == structs.Assigned {
+			reserved = append(reserved, order)
+			delete(free, order.DelegatedID)
+		} else {
+			unplaced = append(unplaced, order)
+		}
+	}
+	for _, order := range unplaced {
+		id, ok := firstCar(order, free)
+		if !ok {
+			waiting = append(waiting, order)
+			continue
+		}
+		order.Status = structs.Assigned
+		order.DelegatedID = id
+		reserved = append(reserved, order)
+		delete(free, id)
+	}
+	return reserved, waiting, free
+}
+
+// firstCar returns the car in states that can serve order first, preferring
+// cars without passengers.
+func firstCar(order structs.HallOrder, states map[string]structs.HRAElevState) (string, bool) {
+	ids := make([]string, 0, len(states))
+	for id := range states {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var hallRequests [config.N_FLOORS][2]bool
+	hallRequests[order.Floor][order.Dir] = true
+	best, bestEmpty, bestTime := "", false, eta.NotServed
+	for _, id := range ids {
+		empty := !hasCabRequests(states[id])
+		t := eta.ServiceTimes(states[id], hallRequests)[order.Floor][order.Dir]
+		if t == eta.NotServed {
+			continue
+		}
+		if best == "" || (empty && !bestEmpty) || (empty == bestEmpty && t < bestTime) {
+			best, bestEmpty, bestTime = id, empty, t
+		}
+	}
+	return best, best != ""
+}
+
+func hasCabRequests(state structs.HRAElevState) bool {
+	for _, cab := range state.CabRequests {
+		if cab {
+			return true
+		}
+	}
+	return false
+}
+
+// committedStops returns states with the assigned orders added as cab
+// requests of their cars, so the assigner treats them as stops it cannot move.
+func committedStops(states map[string]structs.HRAElevState, assigned []structs.HallOrder) map[string]structs.HRAElevState {
+	committed := make(map[string]structs.HRAElevState)
+	for id, state := range states {
+		committed[id] = state
+	}
+	for _, order := range assigned {
+		state, ok := committed[order.DelegatedID]
+		if !ok || order.Status != structs.Assigned {
+			continue
+		}
+		cabRequests := make([]bool, config.N_FLOORS)
+		copy(cabRequests, state.CabRequests)
+		cabRequests[order.Floor] = true
+		state.CabRequests = cabRequests
+		committed[order.DelegatedID] = state
+	}
+	return committed
+}
+
+// getMyPriorities returns the priority of each hall call assigned to myID,
+// to go with the requests from getMyRequests.
+func getMyPriorities(hallOrders []structs.HallOrder, myID string) [config.N_FLOORS][2]structs.Priority {
+	var priorities [config.N_FLOORS][2]structs.Priority
+	for _, order := range hallOrders {
+		if order.DelegatedID == myID && order.Status == structs.Assigned {
+			priorities[order.Floor][order.Dir] = order.Priority
+		}
+	}
+	return priorities
+}
+
+func highest(a structs.Priority, b structs.Priority) structs.Priority {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,89 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestExclusiveCallGetsCarOfItsOwn(t *testing.T) {
+	data := structs.ElevatorDataWithID{
+		ElevatorState: map[string]structs.HRAElevState{"a": structs.IdleAt(0), "b": structs.IdleAt(3)},
+		HallOrders: []structs.HallOrder{
+			{Floor: 0, Dir: elevio.BT_HallUp, Status: structs.Confirmed},
+			{Floor: 1, Dir: elevio.BT_HallUp, Status: structs.Confirmed, Priority: structs.PriorityExclusive},
+			{Floor: 2, Dir: elevio.BT_HallUp, Status: structs.Confirmed},
+		},
+	}
+	for _, order := range assignOrders(data, mcAssign, nil, false).HallOrders {
+		want := "b"
+		if order.Priority == structs.PriorityExclusive {
+			want = "a"
+		}
+		if order.DelegatedID != want {
+			t.Errorf("call at floor %d given to %s, want %s", order.Floor, order.DelegatedID, want)
+		}
+	}
+
+	// A car with passengers is only used if no car is empty
+	busy := structs.IdleAt(0)
+	busy.CabRequests[2] = true
+	data.ElevatorState["a"] = busy
+	for _, order := range assignOrders(data, mcAssign, nil, false).HallOrders {
+		if order.Priority == structs.PriorityExclusive && order.DelegatedID != "b" {
+			t.Errorf("exclusive call given to the car with passengers")
+		}
+	}
+}
+
+func TestPriorityCallsAreAssignedFirst(t *testing.T) {
+	var calls []structs.ElevatorDataWithID
+	recording := func(data structs.ElevatorDataWithID) structs.ElevatorDataWithID {
+		calls = append(calls, data)
+		return mcAssign(data)
+	}
+	data := structs.ElevatorDataWithID{
+		ElevatorState: map[string]structs.HRAElevState{"a": structs.IdleAt(0)},
+		HallOrders: []structs.HallOrder{
+			{Floor: 1, Dir: elevio.BT_HallUp, Status: structs.Confirmed},
+			{Floor: 3, Dir: elevio.BT_HallDown, Status: structs.Confirmed, Priority: structs.PriorityHigh},
+		},
+	}
+	assigned := assignOrders(data, recording, nil, false).HallOrders
+	if len(calls) != 2 || len(calls[0].HallOrders) != 1 || calls[0].HallOrders[0].Floor != 3 {
+		t.Fatalf("priority call not assigned on its own first: %+v", calls)
+	}
+	if !calls[1].ElevatorState["a"].CabRequests[3] {
+		t.Errorf("assigner did not see the priority stop when placing the normal call")
+	}
+	if data.ElevatorState["a"].CabRequests[3] {
+		t.Errorf("priority stop leaked into the elevator state")
+	}
+	for _, order := range assigned {
+		if order.Floor == 3 && order.Priority != structs.PriorityHigh {
+			t.Errorf("assigned call lost its priority")
+		}
+	}
+}
+
+func TestPriorityPressRaisesWaitingCall(t *testing.T) {
+	m := mcNewNode(0)
+	now := mcEpoch
+	press := func(priority structs.Priority) structs.Priority {
+		now = now.Add(time.Second)
+		m.handleLocalOrder(structs.HallOrder{Floor: 2, Dir: elevio.BT_HallUp, Priority: priority}, now)
+		return m.hallOrders[0].Priority
+	}
+	press(structs.PriorityNormal)
+	if got := press(structs.PriorityHigh); got != structs.PriorityHigh {
+		t.Errorf("priority press left the call %v", got)
+	}
+	if got := press(structs.PriorityNormal); got != structs.PriorityHigh {
+		t.Errorf("normal press lowered the call to %v", got)
+	}
+	m.hallOrders[0].Status = structs.Completed
+	if got := press(structs.PriorityNormal); got != structs.PriorityNormal {
+		t.Errorf("served call kept priority %v", got)
+	}
+}
@@ -0,0 +1,76 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"time"
+)
+
+// Fire service recall is a building-wide state that any elevator can set or
+// reset. Each change is stamped with the time it was made and every elevator
+// broadcasts the latest change it knows of, so the newest one reaches all of
+// them whichever elevator it came from, and an elevator that restarts learns
+// it from the others.
+
+// setRecall starts or resets fire service recall from this elevator. Starting
+// it cancels every call, while a reset leaves the calls made since alone.
+func (m *orderManager) setRecall(active bool, now time.Time) {
+	stamp := toMillis(now)
+	if stamp <= m.recall.Stamp {
+		stamp = m.recall.Stamp + 1
+	}
+	m.recall = structs.Recall{Active: active, Floor: config.RecallFloor, Stamp: stamp}
+	m.logf("Fire service recall %s from this elevator\n", recallName(active))
+	if active {
+		m.hallOrders = cancelAllOrders(m.hallOrders)
+		m.cancelAllDestinations()
+	}
+}
+
+// mergeRecall adopts a recall state from another elevator if it is newer.
+// Equal stamps are settled in favour of recall.
+func (m *orderManager) mergeRecall(senderID string, recall *structs.Recall) {
+	if recall == nil || recall.Stamp < m.recall.Stamp ||
+		(recall.Stamp == m.recall.Stamp && (m.recall.Active || !recall.Active)) {
+		return
+	}
+	if recall.Active != m.recall.Active {
+		m.logf("Fire service recall %s by %s\n", recallName(recall.Active), senderID)
+	}
+	m.recall = *recall
+}
+
+// cancelAllOrders cancels every order during recall, which turns off the
+// hall lamps. Calls made during recall are not taken, and the orders stay
+// cancelled after the reset.
+func cancelAllOrders(orders []structs.HallOrder) []structs.HallOrder {
+	for i, order := range orders {
+		if !ended(order.Status) {
+			orders[i].Status = structs.Cancelled
+		}
+	}
+	return orders
+}
+
+// recallMessage returns the recall state to broadcast, nil if there has never been one.
+func (m *orderManager) recallMessage() *structs.Recall {
+	if m.recall.Stamp == 0 {
+		return nil
+	}
+	recall := m.recall
+	return &recall
+}
+
+func sameRecall(a *structs.Recall, b *structs.Recall) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func recallName(active bool) string {
+	if active {
+		return "started"
+	}
+	return "reset"
+}
@@ -0,0 +1,96 @@
+package networkOrders
+
+import (
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func TestRecallReachesEveryElevator(t *testing.T) {
+	master, peer := handoffPair()
+	out := make(chan structs.ElevatorDataWithID, 1)
+	master.publish(master.tick(mcEpoch), mcEpoch, out)
+	peer.handleIncoming(<-out, mcEpoch)
+
+	// Recall started on the peer cancels the order on both elevators
+	now := mcEpoch.Add(time.Second)
+	peer.setRecall(true, now)
+	peer.publish(peer.tick(now), now, out)
+	master.handleIncoming(<-out, now)
+	for _, m := range []*orderManager{master, peer} {
+		if !m.recall.Active || m.recall.Floor != config.RecallFloor {
+			t.Errorf("%s is not in recall: %+v", m.localID, m.recall)
+		}
+		if m.hallOrders[0].Status != structs.Cancelled {
+			t.Errorf("%s still has the order %s", m.localID, m.hallOrders[0].Status)
+		}
+	}
+
+	peer.handleLocalOrder(structs.HallOrder{Floor: 2, Dir: mcCall.Button}, now)
+	if findOrder(peer.hallOrders, 2, mcCall.Button) >= 0 {
+		t.Errorf("hall call taken during recall")
+	}
+
+	// The reset on the master is newer, and a stale message does not undo it
+	stale := peer.networkData(now)
+	later := now.Add(time.Second)
+	master.setRecall(false, later)
+	master.handleIncoming(stale, later)
+	if master.recall.Active {
+		t.Errorf("stale recall undid the reset")
+	}
+	master.publish(master.tick(later), later, out)
+	peer.handleIncoming(<-out, later)
+	if peer.recall.Active {
+		t.Errorf("reset did not reach the peer")
+	}
+}
+
+func TestRecallIsAuditedAsCancelled(t *testing.T) {
+	master, peer := handoffPair()
+	peer.handleIncoming(tickAt(master, peer, mcEpoch), mcEpoch)
+	peer.recordAudit(mcEpoch)
+
+	now := mcEpoch.Add(time.Second)
+	master.setRecall(true, now)
+	peer.handleIncoming(master.tick(now), now)
+	peer.recordAudit(now)
+	if got := peer.hallOrders[0].Status; got != structs.Cancelled {
+		t.Fatalf("peer has the order as %v after recall", got)
+	}
+
+	calls := auditCalls(peer.audit.log.ordered())
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1: %+v", len(calls), calls)
+	}
+	events := calls[0].Events
+	for _, e := range events {
+		if e.Event == "completed" {
+			t.Errorf("abandoned call logged as completed: %+v", events)
+		}
+	}
+	if last := events[len(events)-1]; last.Event != "cancelled" || !last.Time.Equal(now) {
+		t.Errorf("recall logged as %+v, want cancelled at %v", last, now)
+	}
+}
+
+func TestRecallResetKeepsNewCalls(t *testing.T) {
+	m := mcNewNode(0)
+	m.setRecall(true, mcEpoch)
+	now := mcEpoch.Add(time.Second)
+	m.setRecall(false, now)
+
+	m.handleLocalOrder(structs.HallOrder{Floor: mcCall.Floor, Dir: mcCall.Button}, now)
+	id, err := m.addDestination(0, 3, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.setRecall(false, now.Add(time.Second))
+	if got := m.hallOrders[0].Status; got != structs.New {
+		t.Errorf("reset left the hall call %v", got)
+	}
+	if i := findDestination(m.dest.calls, id); i < 0 || ended(m.dest.calls[i].Status) {
+		t.Errorf("reset ended the destination call: %+v", m.dest.calls)
+	}
+}
@@ -0,0 +1,200 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"sanntids/cmd/util"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OrderRow is a hall order as shown by the status API. Ack is "acked" or
+// "pending" for assigned orders this node knows the handoff state of.
+type OrderRow struct {
+	Floor       int                 `json:"floor"`
+	Dir         string              `json:"dir"`
+	Status      string              `json:"status"`
+	DelegatedID string              `json:"delegatedId"`
+	Presses     structs.PressVector `json:"presses"`
+	Priority    string              `json:"priority"`
+	Ack         string              `json:"ack,omitempty"`
+	AckRetries  int                 `json:"ackRetries,omitempty"`
+	Deadline    *time.Time          `json:"deadline,omitempty"`
+	ETA         *time.Time          `json:"eta,omitempty"`
+}
+
+// DestinationRow is a destination call as shown by the status API. Car is
+// the elevator the passenger should board, empty until the master has chosen one.
+type DestinationRow struct {
+	ID     string `json:"id"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Status string `json:"status"`
+	Car    string `json:"car"`
+}
+
+// FlaggedElevator is an elevator the master has left out of assignment.
+type FlaggedElevator struct {
+	ID     string    `json:"id"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+}
+
+// Status is what the order manager shows to the status API.
+type Status struct {
+	LocalID  string `json:"localId"`
+	View     string `json:"view"`
+	Master   bool   `json:"master"`
+	Isolated bool   `json:"isolated"`
+	// Reassignments counts the assigned orders this node, as master, moved to another elevator
+	Reassignments uint64            `json:"reassignments"`
+	Flagged       []FlaggedElevator `json:"flagged"`
+	Orders        []OrderRow        `json:"orders"`
+	ETAAccuracy   ETAAccuracy       `json:"etaAccuracy"`
+	// ParkingStrategy is how this node parks idle elevators when it is master
+	ParkingStrategy ParkingStrategy `json:"parkingStrategy"`
+	// Parking is the floor each idle elevator waits at, as set by the master
+	Parking     map[string]int `json:"parking"`
+	TrafficMode TrafficMode    `json:"trafficMode"`
+	// Maintenance lists the elevators that are out of service
+	Maintenance []string `json:"maintenance"`
+	// Full lists the elevators whose load sensor says they are full
+	Full         []string         `json:"full"`
+	Recall       structs.Recall   `json:"recall"`
+	Destinations []DestinationRow `json:"destinations"`
+}
+
+var currentStatus = struct {
+	sync.Mutex
+	status Status
+}{}
+
+// GetStatus returns the order table as of the last tick.
+func GetStatus() Status {
+	currentStatus.Lock()
+	defer currentStatus.Unlock()
+	return currentStatus.status
+}
+
+// publishStatus makes the orders in view available to GetStatus.
+func (m *orderManager) publishStatus(view structs.ElevatorDataWithID) {
+	master := util.IsMaster(m.ipMap, m.localID)
+	status := Status{
+		LocalID:         m.localID,
+		View:            string(m.view),
+		Master:          master,
+		Isolated:        m.isolated,
+		Reassignments:   m.reassignments,
+		ETAAccuracy:     m.arrivals.accuracy(),
+		ParkingStrategy: m.parkingMode,
+		TrafficMode:     m.trafficMode,
+		Parking:         make(map[string]int),
+		Maintenance:     make([]string, 0),
+		Full:            make([]string, 0),
+		Recall:          m.recall,
+		Flagged:         make([]FlaggedElevator, 0, len(m.flagged)),
+		Orders:          make([]OrderRow, 0, len(view.HallOrders)),
+		Destinations:    make([]DestinationRow, 0, len(m.dest.calls)),
+	}
+	for _, call := range m.dest.calls {
+		status.Destinations = append(status.Destinations, destinationRow(call))
+	}
+	for id, f := range m.flagged {
+		status.Flagged = append(status.Flagged, FlaggedElevator{ID: id, Reason: f.reason, Since: f.since})
+	}
+	for id, floor := range m.parking {
+		if floor >= 0 {
+			status.Parking[id] = floor
+		}
+	}
+	for id, state := range m.elevatorStates {
+		if state.Maintenance {
+			status.Maintenance = append(status.Maintenance, id)
+		}
+		if state.LoadKg >= config.FullLoadKg {
+			status.Full = append(status.Full, id)
+		}
+	}
+	sort.Strings(status.Maintenance)
+	sort.Strings(status.Full)
+	sort.Slice(status.Flagged, func(i, j int) bool { return status.Flagged[i].ID < status.Flagged[j].ID })
+
+	for _, order := range view.HallOrders {
+		row := OrderRow{
+			Floor:       order.Floor,
+			Dir:         dirName(order.Dir),
+			Status:      order.Status.String(),
+			DelegatedID: order.DelegatedID,
+			Presses:     order.Presses,
+			Priority:    order.Priority.String(),
+		}
+		if order.ETA != 0 {
+			eta := fromMillis(order.ETA)
+			row.ETA = &eta
+		}
+		if order.Status == structs.Assigned {
+			if h, ok := m.handoffs[orderKey{order.Floor, order.Dir}]; master && ok {
+				row.Ack = ackName(h.acked)
+				row.AckRetries = h.retries
+				deadline := h.deadline
+				row.Deadline = &deadline
+			} else if order.DelegatedID == m.localID {
+				row.Ack = ackName(true)
+			}
+		}
+		status.Orders = append(status.Orders, row)
+	}
+	sort.Slice(status.Orders, func(i, j int) bool {
+		a, b := status.Orders[i], status.Orders[j]
+		return a.Floor < b.Floor || (a.Floor == b.Floor && a.Dir < b.Dir)
+	})
+
+	currentStatus.Lock()
+	currentStatus.status = status
+	currentStatus.Unlock()
+}
+
+func ackName(acked bool) string {
+	if acked {
+		return "acked"
+	}
+	return "pending"
+}
+
+func dirName(dir elevio.ButtonType) string {
+	switch dir {
+	case elevio.BT_HallUp:
+		return "up"
+	case elevio.BT_HallDown:
+		return "down"
+	}
+	return "cab"
+}
+
+// CallETA is when a hall call is expected to be served, for hall displays.
+type CallETA struct {
+	Floor       int       `json:"floor"`
+	Dir         string    `json:"dir"`
+	Elevator    string    `json:"elevator"`
+	ETA         time.Time `json:"eta"`
+	SecondsLeft float64   `json:"secondsLeft"`
+}
+
+// GetETAs returns the expected arrival at every assigned hall call as of the last tick.
+func GetETAs(now time.Time) []CallETA {
+	status := GetStatus()
+	etas := make([]CallETA, 0, len(status.Orders))
+	for _, row := range status.Orders {
+		if row.ETA == nil {
+			continue
+		}
+		left := row.ETA.Sub(now).Seconds()
+		if left < 0 {
+			left = 0
+		}
+		etas = append(etas, CallETA{Floor: row.Floor, Dir: row.Dir, Elevator: row.DelegatedID, ETA: *row.ETA, SecondsLeft: left})
+	}
+	return etas
+}
@@ -0,0 +1,164 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"fmt"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"sort"
+	"time"
+)
+
+// TrafficMode is the traffic pattern the master dispatches for.
+type TrafficMode string
+
+const (
+	// Interfloor is ordinary traffic between floors.
+	Interfloor TrafficMode = "interfloor"
+	// UpPeak is the morning rush from the lobby. Idle elevators park at
+	// and next to the lobby.
+	UpPeak TrafficMode = "up-peak"
+	// DownPeak is the evening rush down to the lobby. Each elevator gets a
+	// zone of floors and the calls in it.
+	DownPeak TrafficMode = "down-peak"
+)
+
+// TrafficSource is how the master decides the traffic mode.
+type TrafficSource string
+
+const (
+	// TrafficFromCalls detects the mode from the recent hall calls.
+	TrafficFromCalls TrafficSource = "calls"
+	// TrafficFromSchedule takes the mode from config.TrafficSchedule.
+	TrafficFromSchedule TrafficSource = "schedule"
+	// TrafficOff always dispatches for interfloor traffic.
+	TrafficOff TrafficSource = "off"
+)
+
+// ParseTrafficSource checks a traffic source given on the command line.
+func ParseTrafficSource(name string) (TrafficSource, error) {
+	switch source := TrafficSource(name); source {
+	case TrafficFromCalls, TrafficFromSchedule, TrafficOff:
+		return source, nil
+	}
+	return TrafficOff, fmt.Errorf("unknown traffic source %q", name)
+}
+
+type hallCall struct {
+	at    time.Time
+	floor int
+	dir   elevio.ButtonType
+}
+
+// trafficStats holds the hall calls of the last config.TrafficWindowMs.
+type trafficStats struct {
+	calls []hallCall
+}
+
+func (t *trafficStats) record(floor int, dir elevio.ButtonType, now time.Time) {
+	t.calls = append(t.calls, hallCall{at: now, floor: floor, dir: dir})
+}
+
+func (t *trafficStats) prune(now time.Time) {
+	window := config.TrafficWindowMs * time.Millisecond
+	i := 0
+	for i < len(t.calls) && now.Sub(t.calls[i].at) > window {
+		i++
+	}
+	t.calls = append([]hallCall(nil), t.calls[i:]...)
+}
+
+// detect returns the traffic mode of the recent calls. A peak starts when
+// its share of the calls reaches TrafficPeakEnterShare and lasts until it
+// falls below TrafficPeakLeaveShare, so the mode does not flap.
+func (t *trafficStats) detect(current TrafficMode, now time.Time) TrafficMode {
+	t.prune(now)
+	if len(t.calls) < config.TrafficMinCalls {
+		return Interfloor
+	}
+	up, down := 0, 0
+	for _, call := range t.calls {
+		switch {
+		case call.floor == config.LobbyFloor && call.dir == elevio.BT_HallUp:
+			up++
+		case call.floor != config.LobbyFloor && call.dir == elevio.BT_HallDown:
+			down++
+		}
+	}
+	reached := func(mode TrafficMode, count int) bool {
+		share := config.TrafficPeakEnterShare
+		if current == mode {
+			share = config.TrafficPeakLeaveShare
+		}
+		return float64(count) >= share*float64(len(t.calls))
+	}
+	switch {
+	case reached(UpPeak, up):
+		return UpPeak
+	case reached(DownPeak, down):
+		return DownPeak
+	}
+	return Interfloor
+}
+
+// scheduledMode returns the traffic mode config.TrafficSchedule gives for now.
+func scheduledMode(now time.Time) TrafficMode {
+	hour := now.Hour()
+	for _, period := range config.TrafficSchedule {
+		if hour >= period.FromHour && hour < period.ToHour {
+			return TrafficMode(period.Mode)
+		}
+	}
+	return Interfloor
+}
+
+// recordCalls counts the orders in pending that the master has just confirmed.
+func (m *orderManager) recordCalls(pending []structs.HallOrder, now time.Time) {
+	for _, order := range pending {
+		if i := findOrder(m.hallOrders, order.Floor, order.Dir); i >= 0 && m.hallOrders[i].Status == structs.Confirmed {
+			m.traffic.record(order.Floor, order.Dir, now)
+		}
+	}
+}
+
+// updateTrafficMode is run by the master every tick.
+func (m *orderManager) updateTrafficMode(now time.Time) {
+	mode := Interfloor
+	switch m.trafficSource {
+	case TrafficFromCalls:
+		mode = m.traffic.detect(m.trafficMode, now)
+	case TrafficFromSchedule:
+		mode = scheduledMode(now)
+	}
+	if mode != m.trafficMode && m.trafficMode != "" {
+		m.logf("Traffic mode changed from %s to %s\n", m.trafficMode, mode)
+	}
+	m.trafficMode = mode
+}
+
+// zoneAssignments gives every pending order to the elevator whose zone its
+// floor is in. The floors are split into one band per elevator that can
+// take orders, in the order of their IDs.
+func zoneAssignments(assigned []structs.HallOrder, states map[string]structs.HRAElevState) {
+	ids := make([]string, 0, len(states))
+	for id := range states {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	sort.Strings(ids)
+	for i, order := range assigned {
+		assigned[i].DelegatedID = ids[order.Floor*len(ids)/config.N_FLOORS]
+	}
+}
+
+func unconfirmed(orders []structs.HallOrder) []structs.HallOrder {
+	var pending []structs.HallOrder
+	for _, order := range orders {
+		if order.Status == structs.New {
+			pending = append(pending, order)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,92 @@
+package networkOrders
+
+import (
+	"Driver-go/elevio"
+	"sanntids/cmd/config"
+	"sanntids/cmd/structs"
+	"testing"
+	"time"
+)
+
+func callsAt(t *trafficStats, n int, floor int, dir elevio.ButtonType, now time.Time) {
+	for i := 0; i < n; i++ {
+		t.record(floor, dir, now)
+	}
+}
+
+func TestDetectTrafficMode(t *testing.T) {
+	var stats trafficStats
+	callsAt(&stats, config.TrafficMinCalls-1, config.LobbyFloor, elevio.BT_HallUp, mcEpoch)
+	if mode := stats.detect(Interfloor, mcEpoch); mode != Interfloor {
+		t.Errorf("too few calls gave %s", mode)
+	}
+	callsAt(&stats, 1, config.LobbyFloor, elevio.BT_HallUp, mcEpoch)
+	if mode := stats.detect(Interfloor, mcEpoch); mode != UpPeak {
+		t.Errorf("lobby rush gave %s, want %s", mode, UpPeak)
+	}
+
+	// Half the calls is not enough to start a peak, but enough to keep one going
+	callsAt(&stats, config.TrafficMinCalls, 2, elevio.BT_HallDown, mcEpoch)
+	if mode := stats.detect(Interfloor, mcEpoch); mode != Interfloor {
+		t.Errorf("mixed traffic gave %s", mode)
+	}
+	if mode := stats.detect(UpPeak, mcEpoch); mode != UpPeak {
+		t.Errorf("up-peak ended at half the calls, got %s", mode)
+	}
+
+	later := mcEpoch.Add(config.TrafficWindowMs*time.Millisecond + time.Second)
+	callsAt(&stats, config.TrafficMinCalls, 3, elevio.BT_HallDown, later)
+	if mode := stats.detect(UpPeak, later); mode != DownPeak {
+		t.Errorf("evening rush gave %s, want %s", mode, DownPeak)
+	}
+}
+
+func TestZoneAssignments(t *testing.T) {
+	states := map[string]structs.HRAElevState{"b": structs.IdleAt(0), "a": structs.IdleAt(3)}
+	var orders []structs.HallOrder
+	for floor := 0; floor < config.N_FLOORS; floor++ {
+		orders = append(orders, structs.HallOrder{Floor: floor, Dir: elevio.BT_HallDown, Status: structs.Assigned, DelegatedID: "b"})
+	}
+	zoneAssignments(orders, states)
+	for _, order := range orders {
+		want := "a"
+		if order.Floor >= config.N_FLOORS/2 {
+			want = "b"
+		}
+		if order.DelegatedID != want {
+			t.Errorf("call at floor %d given to %s, want %s", order.Floor, order.DelegatedID, want)
+		}
+	}
+}
+
+func TestZoningMovesAssignedCalls(t *testing.T) {
+	// b is next to the call, so without zones the call would stay with it
+	data := structs.ElevatorDataWithID{
+		ElevatorState: map[string]structs.HRAElevState{"a": structs.IdleAt(3), "b": structs.IdleAt(1)},
+		HallOrders:    []structs.HallOrder{{Floor: 1, Dir: elevio.BT_HallDown, Status: structs.Assigned, DelegatedID: "b"}},
+	}
+	if got := assignOrders(data, mcAssign, nil, false).HallOrders[0].DelegatedID; got != "b" {
+		t.Fatalf("call moved to %s without zones", got)
+	}
+	if got := assignOrders(data, mcAssign, nil, true).HallOrders[0].DelegatedID; got != "a" {
+		t.Errorf("call in a's zone kept by %s after zoning started", got)
+	}
+}
+
+func TestMasterDetectsTrafficFromConfirmedCalls(t *testing.T) {
+	master, peer := handoffPair()
+	master.trafficSource = TrafficFromCalls
+	now := mcEpoch.Add(time.Second)
+	for i := 0; i < config.TrafficMinCalls; i++ {
+		master.hallOrders = []structs.HallOrder{newPress(config.LobbyFloor, elevio.BT_HallUp, structs.PressVector{peer.localID: int64(i)})}
+		master.hallOrdersMap[peer.localID] = master.hallOrders
+		master.hallOrdersMap[master.localID] = master.hallOrders
+		tickAt(master, peer, now)
+	}
+	if master.trafficMode != UpPeak {
+		t.Fatalf("master is in %s after a lobby rush, want %s", master.trafficMode, UpPeak)
+	}
+	if got := master.parking[peer.localID]; got != config.LobbyFloor {
+		t.Errorf("idle peer parks at %d during up-peak, want the lobby", got)
+	}
+}
@@ -0,0 +1,93 @@
+package statusAPI
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Source returns the current value of something shown by the status API.
+type Source func() interface{}
+
+// Action changes something about the elevator. It gets the body of a POST
+// request and returns the value to answer with, or an error if the request
+// was not valid.
+type Action func(body []byte) (interface{}, error)
+
+// Text can be returned by a Source to answer with a body that is not JSON,
+// such as an export in another format.
+type Text struct {
+	ContentType string
+	Body        []byte
+}
+
+// Largest request body an Action is given
+const maxBodyBytes = 1 << 16
+
+// Serve answers GET requests on addr with the JSON encoded value of the
+// source registered for the path, and POST requests by running its action.
+// It is meant for tooling on the lab network. Since actions change how the
+// elevator behaves, addr should not be reachable from outside it.
+func Serve(addr string, sources map[string]Source, actions map[string]Action) {
+	mux := http.NewServeMux()
+	paths := make(map[string]bool)
+	for path := range sources {
+		paths[path] = true
+	}
+	for path := range actions {
+		paths[path] = true
+	}
+	for path := range paths {
+		mux.HandleFunc(path, handler(sources[path], actions[path]))
+	}
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Println("Error serving status API:", err)
+	}
+}
+
+func handler(source Source, action Action) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && source != nil:
+			value := source()
+			if text, ok := value.(Text); ok {
+				writeText(w, text)
+				return
+			}
+			writeJSON(w, value)
+
+		case r.Method == http.MethodPost && action != nil:
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result, err := action(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, result)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(value); err != nil {
+		fmt.Println("Error writing status:", err)
+	}
+}
+
+func writeText(w http.ResponseWriter, text Text) {
+	w.Header().Set("Content-Type", text.ContentType)
+	if _, err := w.Write(text.Body); err != nil {
+		fmt.Println("Error writing status:", err)
+	}
+}
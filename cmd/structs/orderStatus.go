@@ -0,0 +1,71 @@
+package structs
+
+// The lifecycle of one press of a hall button:
+//
+//	Unknown ──► New ──► Confirmed ──► Assigned ──► Completed
+//	             │          │          ▲  │  │         │
+//	             │          │          └──┘  │         │
+//	             └──────────┴──► Cancelled ◄─┘         │
+//	                                 │                 │
+//	             New ◄───────────────┴─ pressed again ─┘
+//
+// New means a hall button was pressed on some node. The order is Confirmed
+// once the master has seen every live node report it, which lights the lamp.
+// Assigned means the master has chosen an elevator (DelegatedID) to serve it;
+// it may be reassigned, e.g. when that elevator disappears. Completed means
+// the assigned elevator has served it, and pressing the button again starts
+// over with a new HallOrder.Presses. Cancelled means someone took the call
+// back before it was served; like Completed it turns off the lamp and is
+// left behind by the next press.
+//
+// A node that lags behind may skip forward, e.g. from New straight to
+// Assigned or Completed when it learns the master's view late, but a press
+// never moves backwards. Unknown is the status of an order a node has never
+// heard of, and may jump to whatever status the network reports. These rules
+// apply to one set of presses; an order whose Presses change is a new order.
+var legalTransitions = map[OrderStatus][]OrderStatus{
+	Unknown:   {New, Confirmed, Assigned, Completed, Cancelled},
+	New:       {Confirmed, Assigned, Completed, Cancelled},
+	Confirmed: {Assigned, Completed, Cancelled},
+	Assigned:  {Assigned, Completed, Cancelled},
+	Completed: {New},
+	Cancelled: {New},
+}
+
+func (s OrderStatus) String() string {
+	switch s {
+	case Unknown:
+		return "Unknown"
+	case New:
+		return "New"
+	case Confirmed:
+		return "Confirmed"
+	case Assigned:
+		return "Assigned"
+	case Completed:
+		return "Completed"
+	case Cancelled:
+		return "Cancelled"
+	default:
+		return "Invalid"
+	}
+}
+
+// CanTransitionTo reports whether an order may move from s to next.
+// Staying in the same status is always allowed.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	if s == next {
+		return true
+	}
+	for _, allowed := range legalTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the order still waits to be served, which is when its lamp is lit.
+func (s OrderStatus) IsActive() bool {
+	return s == Confirmed || s == Assigned
+}
@@ -0,0 +1,45 @@
+package structs
+
+// PressVector records, for every elevator, the time in milliseconds of the
+// latest press of a hall button on its panel that an order covers. An order
+// is only served for the presses its vector covers, so a press is never
+// swallowed by a copy of the order that was served before it happened.
+type PressVector map[string]int64
+
+// With returns a copy of v that also covers a press on elevator id at stamp.
+func (v PressVector) With(id string, stamp int64) PressVector {
+	result := v.Merge(nil)
+	if stamp <= result[id] {
+		stamp = result[id] + 1
+	}
+	result[id] = stamp
+	return result
+}
+
+// Merge returns a vector covering the presses of both v and other.
+func (v PressVector) Merge(other PressVector) PressVector {
+	result := make(PressVector, len(v))
+	for id, stamp := range v {
+		result[id] = stamp
+	}
+	for id, stamp := range other {
+		if stamp > result[id] {
+			result[id] = stamp
+		}
+	}
+	return result
+}
+
+// Covers reports whether every press in other is also in v.
+func (v PressVector) Covers(other PressVector) bool {
+	for id, stamp := range other {
+		if v[id] < stamp {
+			return false
+		}
+	}
+	return true
+}
+
+func (v PressVector) Equal(other PressVector) bool {
+	return v.Covers(other) && other.Covers(v)
+}
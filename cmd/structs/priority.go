@@ -0,0 +1,38 @@
+package structs
+
+import "fmt"
+
+// Priority is the service level of a hall call. Normal calls are what the
+// hall buttons give. The master assigns Priority calls before the others,
+// and a car with one passes normal hall calls on its way. An Exclusive call
+// gets a car of its own, which only stops for its cab calls on the way.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	PriorityExclusive
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "priority"
+	case PriorityExclusive:
+		return "exclusive"
+	default:
+		return "invalid"
+	}
+}
+
+// ParsePriority returns the priority with the given name, as printed by String.
+func ParsePriority(name string) (Priority, error) {
+	for _, p := range []Priority{PriorityNormal, PriorityHigh, PriorityExclusive} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q", name)
+}
@@ -2,6 +2,7 @@ package structs
 
 import (
 	"Driver-go/elevio"
+	"sanntids/cmd/config"
 )
 
 type OrderStatus int
@@ -12,14 +13,25 @@ const (
 	Confirmed
 	Assigned
 	Completed
+	Cancelled
 )
 
 // Using `json:"1"`,`json:"2"`.. to save data when sending
+// Presses identifies which presses of the button the order stands for.
+// AckedBy is set by the elevator an order is assigned to, to acknowledge it.
+// ETA is when the master expects that elevator at the floor, in Unix milliseconds.
+// Priority is the service level asked for by the presses.
 type HallOrder struct {
 	DelegatedID string   		  `json:"1"`
 	Status      OrderStatus       `json:"2"`
 	Floor       int			      `json:"3"`
 	Dir         elevio.ButtonType `json:"4"`
+	Presses     PressVector       `json:"10"`
+	AckedBy     string            `json:"15,omitempty"`
+	ETA         int64             `json:"16,omitempty"`
+	Priority    Priority          `json:"23,omitempty"`
+	// AssignedBy is the master that gave the order to DelegatedID
+	AssignedBy  string            `json:"24,omitempty"`
 }
 
 type HRAElevState struct {
@@ -29,10 +41,81 @@ type HRAElevState struct {
     Floor       int         `json:"floor"` 
     Direction   string      `json:"direction"`
     CabRequests []bool      `json:"cabRequests"`
+    Maintenance bool        `json:"19,omitempty"`
+    LoadKg      int         `json:"21,omitempty"`
 }
 
+// IdleAt returns the state of an idle elevator at floor with no cab calls.
+func IdleAt(floor int) HRAElevState {
+	return HRAElevState{Behavior: "idle", Floor: floor, Direction: "stop", CabRequests: make([]bool, config.N_FLOORS)}
+}
+
+// DestinationCall is a call from a destination keypad: a passenger at From
+// going to To. Car is the elevator the master has told them to board, and
+// Created is when the call was entered, in Unix milliseconds.
+type DestinationCall struct {
+	ID      string      `json:"1"`
+	From    int         `json:"2"`
+	To      int         `json:"3"`
+	Status  OrderStatus `json:"4"`
+	Car     string      `json:"5,omitempty"`
+	Created int64       `json:"6"`
+}
+
+// Recall is the fire service recall state of the building. While Active all
+// elevators go to Floor and wait there with the door open. Stamp is when it
+// was last started or reset, in Unix milliseconds.
+type Recall struct {
+	Active bool  `json:"active"`
+	Floor  int   `json:"floor"`
+	Stamp  int64 `json:"stamp"`
+}
+
+// Maintenance takes an elevator out of service. Floor is where it waits
+// with the door open, -1 to stay where it is.
+type Maintenance struct {
+	On    bool `json:"on"`
+	Floor int  `json:"floor"`
+}
+
+// LocalOrders is what the order manager hands the local elevator every
+// tick: its requests and their priorities, where to park, and the recall.
+type LocalOrders struct {
+	Requests   [config.N_FLOORS][config.N_BUTTONS]bool
+	Priorities [config.N_FLOORS][2]Priority
+	ParkFloor  int
+	Recall     Recall
+}
+
+// A Snapshot carries everything the sender knows, a Delta only what changed
+// since its previous message, and a SnapshotRequest asks Target for a Snapshot.
+type MessageKind int
+
+const (
+	Snapshot MessageKind = iota
+	Delta
+	SnapshotRequest
+)
+
+// ViewID names the set of elevators a node currently sees, so nodes can
+// tell when they have been in different partitions of the network.
+type ViewID string
+
+// Seq counts the messages from ElevatorID, so receivers can notice a lost Delta.
+// View is the sender's view when it sent the message. Parking is set by the
+// master and gives the floor each elevator should wait at while idle, -1 for none.
+// Traffic is the master's traffic mode. Recall is the newest fire service
+// recall state the sender knows of. Destinations are destination keypad calls.
 type ElevatorDataWithID struct {
 	ElevatorID string  					  `json:"7"`
 	ElevatorState map[string]HRAElevState `json:"8"`
 	HallOrders    []HallOrder  			  `json:"9"`
+	Kind          MessageKind             `json:"11"`
+	Seq           uint64                  `json:"12"`
+	Target        string                  `json:"13,omitempty"`
+	View          ViewID                  `json:"14"`
+	Parking       map[string]int          `json:"17,omitempty"`
+	Traffic       string                  `json:"18,omitempty"`
+	Recall        *Recall                 `json:"20,omitempty"`
+	Destinations  []DestinationCall       `json:"22,omitempty"`
 }
\ No newline at end of file